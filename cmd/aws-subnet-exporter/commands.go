@@ -0,0 +1,173 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/aggregate"
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/aws"
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/generate"
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/utils"
+)
+
+// Run a subcommand instead of the exporter, e.g. aws-subnet-exporter -region eu-west-2 advise -vpc vpc-123
+func runCommand(args []string) error {
+	switch args[0] {
+	case "advise":
+		return runAdvise(args[1:])
+	case "rules":
+		return runRules(args[1:])
+	case "dashboard":
+		return runDashboard(args[1:])
+	case "free-ips":
+		return runFreeIPs(args[1:])
+	default:
+		return fmt.Errorf("unknown command: %s", args[0])
+	}
+}
+
+// Print candidate CIDR blocks for a new subnet, one per line
+func runAdvise(args []string) error {
+	fs := flag.NewFlagSet("advise", flag.ExitOnError)
+	vpcID := fs.String("vpc", "", "ID of the VPC to place the subnet in")
+	prefixLength := fs.Int("prefix-length", 24, "Prefix length of the new subnet")
+	az := fs.String("az", "", "Availability zone of the new subnet, prefers blocks next to its existing subnets")
+	count := fs.Int("count", 5, "Number of candidates to suggest")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *vpcID == "" {
+		return fmt.Errorf("-vpc is required")
+	}
+
+	client, err := aws.InitEC2Client(*region)
+	if err != nil {
+		return err
+	}
+	vpcs, err := aws.GetVPCs(client, []string{*vpcID})
+	if err != nil {
+		return err
+	}
+	if len(vpcs) == 0 {
+		return fmt.Errorf("VPC not found: %s", *vpcID)
+	}
+	suggestions, err := aggregate.SuggestSubnetCIDRs(vpcs[0], *prefixLength, *az, *count)
+	if err != nil {
+		return err
+	}
+	if len(suggestions) == 0 {
+		return fmt.Errorf("no free /%d block in %s", *prefixLength, *vpcID)
+	}
+	for _, s := range suggestions {
+		fmt.Fprintln(os.Stdout, s.String())
+	}
+	return nil
+}
+
+// Print the first free IPs of a subnet that can be assigned as static private IPs, one per line
+func runFreeIPs(args []string) error {
+	fs := flag.NewFlagSet("free-ips", flag.ExitOnError)
+	subnetID := fs.String("subnet", "", "ID of the subnet")
+	count := fs.Int("count", 5, fmt.Sprintf("Number of free IPs to print, at most %d", utils.MaxFreeIPs))
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *subnetID == "" {
+		return fmt.Errorf("-subnet is required")
+	}
+
+	client, err := aws.InitEC2Client(*region)
+	if err != nil {
+		return err
+	}
+	subnet, err := aws.GetSubnetByID(client, *subnetID)
+	if err != nil {
+		return err
+	}
+	free, err := subnet.FreeAddresses(*count)
+	if err != nil {
+		return err
+	}
+	if len(free) == 0 {
+		return fmt.Errorf("no free IPs in %s", *subnetID)
+	}
+	for _, ip := range free {
+		fmt.Fprintln(os.Stdout, ip)
+	}
+	return nil
+}
+
+// Print alerting rules for the metrics exported with the global -namespace and -const-labels
+func runRules(args []string) error {
+	fs := flag.NewFlagSet("rules", flag.ExitOnError)
+	format := fs.String("format", generate.FormatPrometheusRule, "Output format, prometheusrule for the Prometheus operator or rules for a plain rule file")
+	name := fs.String("name", "aws-subnet-exporter", "Name of the PrometheusRule resource")
+	resourceLabels := fs.String("resource-labels", "", "Comma separated key=value labels of the PrometheusRule resource, e.g. release=prometheus")
+	alertLabels := fs.String("labels", "", "Comma separated key=value labels added to every alert, e.g. team=platform")
+	minFreeIPs := fs.Int("min-free-ips", 50, "Alert when a subnet has fewer available IPs, 0 disables the alert")
+	maxUtilization := fs.Float64("max-utilization", 0.9, "Alert when the utilization ratio of a subnet is higher, 0 disables the alert")
+	minAvailablePrefixes := fs.Int("min-available-prefixes", 0, "Alert when a subnet has fewer available /28 prefixes, 0 disables the alert")
+	exhaustionWindow := fs.Duration("exhaustion-window", 24*time.Hour, "Alert when a subnet is predicted to run out within this window, 0 disables the alert")
+	minVPCUnallocated := fs.Float64("min-vpc-unallocated-ratio", 0.1, "Alert when less of the VPC address space is left for new subnets, 0 disables the alert")
+	forDuration := fs.Duration("for", 15*time.Minute, "Time a condition has to hold before an alert fires")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	labels, err := utils.ParseLabels(*alertLabels)
+	if err != nil {
+		return err
+	}
+	metadataLabels, err := utils.ParseLabels(*resourceLabels)
+	if err != nil {
+		return err
+	}
+
+	group, err := generate.Rules(generate.RuleOptions{
+		MinFreeIPs:             *minFreeIPs,
+		MaxUtilization:         *maxUtilization,
+		MinAvailablePrefixes:   *minAvailablePrefixes,
+		ExhaustionWindow:       *exhaustionWindow,
+		MinVPCUnallocatedRatio: *minVPCUnallocated,
+		For:                    *forDuration,
+		Labels:                 labels,
+	})
+	if err != nil {
+		return err
+	}
+	out, err := generate.RulesYAML(group, *format, *name, metadataLabels)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(out)
+	return err
+}
+
+// Print a Grafana dashboard for the metrics exported with the global -namespace
+func runDashboard(args []string) error {
+	fs := flag.NewFlagSet("dashboard", flag.ExitOnError)
+	title := fs.String("title", "AWS subnets", "Title of the dashboard")
+	uid := fs.String("uid", "aws-subnet-exporter", "UID of the dashboard")
+	accountLabel := fs.String("account-label", "account", "Label holding the AWS account, e.g. set with -const-labels")
+	regionLabel := fs.String("region-label", "region", "Label holding the AWS region, e.g. set with -const-labels")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	dashboard, err := generate.BuildDashboard(generate.DashboardOptions{
+		Title:        *title,
+		UID:          *uid,
+		AccountLabel: *accountLabel,
+		RegionLabel:  *regionLabel,
+	})
+	if err != nil {
+		return err
+	}
+	out, err := generate.DashboardJSON(dashboard)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(out)
+	return err
+}
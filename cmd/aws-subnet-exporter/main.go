@@ -1,12 +1,22 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"net/http"
 	"time"
 
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/aggregate"
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/api"
 	"github.com/ministryofjustice/aws-subnet-exporter/pkg/aws"
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/capacity"
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/events"
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/forecast"
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/kubernetes"
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/notify"
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/policy"
 	prom "github.com/ministryofjustice/aws-subnet-exporter/pkg/prometheus"
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/requirements"
 	"github.com/ministryofjustice/aws-subnet-exporter/pkg/utils"
 	log "github.com/sirupsen/logrus"
 )
@@ -15,6 +25,14 @@ const (
 	errGoRoutineStopped = "go routine for getting subnets stopped"
 	metricsEndpoint     = "/metrics"
 	healthEndpoint      = "/healthz"
+	debugEndpoint       = "/debug/subnets"
+	imbalanceEndpoint   = "/api/v1/imbalance"
+	adviseEndpoint      = "/api/v1/advise"
+	subnetsEndpoint     = api.SubnetsPath
+	ipEndpoint          = api.IPPath + "/"
+
+	// Refreshes of events held for the sinks before new ones are dropped
+	eventQueueSize = 64
 )
 
 var (
@@ -23,21 +41,129 @@ var (
 	filter = flag.String("filter", "*", "Filter subnets by tag regex when calling AWS (assumes tag key is Name")
 	period = flag.Duration("period", 60*time.Second, "Period for calling AWS in seconds")
 	debug  = flag.Bool("debug", false, "Enable debug logging")
+
+	namespace      = flag.String("namespace", prom.DefaultNamespace, "Namespace prepended to exported metric names")
+	constLabels    = flag.String("const-labels", "", "Comma separated key=value labels added to every metric, e.g. cluster=live,environment=production")
+	runtimeMetrics = flag.Bool("runtime-metrics", true, "Export Go runtime and process metrics")
+	groupTags      = flag.String("group-tags", "", "Comma separated tag keys to aggregate subnets by, e.g. tier")
+
+	cniMode             = flag.String("cni-mode", string(capacity.ModePrefix), "VPC CNI mode used to estimate pod capacity, prefix or secondary-ip")
+	cniWarmIPTarget     = flag.Int("cni-warm-ip-target", 0, "WARM_IP_TARGET of the VPC CNI")
+	cniMinimumIPTarget  = flag.Int("cni-minimum-ip-target", 0, "MINIMUM_IP_TARGET of the VPC CNI")
+	cniWarmPrefixTarget = flag.Int("cni-warm-prefix-target", 1, "WARM_PREFIX_TARGET of the VPC CNI")
+	cniPodENI           = flag.Bool("cni-pod-eni", false, "ENABLE_POD_ENI of the VPC CNI, nodes get a trunk network interface")
+	cniBranchPodRatio   = flag.Float64("cni-branch-pod-ratio", 0, "Share of new pods using security groups for pods, between 0 and 1")
+	maxPodsPerNode      = flag.Int("max-pods-per-node", capacity.DefaultMaxPodsPerNode, "Pod limit of a node used to estimate pod capacity")
+	attributeUsage      = flag.Bool("attribute-usage", false, "Break down subnet usage by EKS cluster and node group, requires ec2:DescribeInstances")
+	instanceTypes       = flag.String("instance-types", "", "Comma separated instance types to estimate node headroom for, e.g. m5.large,m5.xlarge")
+
+	serviceRequirements = flag.String("requirements", "", "Comma separated extra or overridden service requirements in the form name:min-free-ips[:tag], e.g. opensearch:12:aws-subnet-exporter/opensearch")
+	forecastLookback    = flag.Duration("forecast-lookback", 6*time.Hour, "Window of free IP and prefix history used to predict subnet exhaustion, 0 disables the prediction")
+	policyFile          = flag.String("policy-file", "", "YAML file of policy rules evaluated against every subnet")
+	eventSinks          = flag.String("event-sinks", "", "Comma separated sinks for subnet change events: stdout, file:<path> or webhook:<url>")
+	utilizationBands    = flag.String("utilization-bands", events.DefaultUtilizationBands, "Comma separated utilization ratios whose crossing raises an event")
+	notifyConfig        = flag.String("notify-config", "", "YAML file of thresholds and webhooks to notify when subnets breach them")
+
+	eniConfig  = flag.Bool("eniconfig", false, "Label subnets with the ENIConfigs of EKS custom networking that use them")
+	podIPs     = flag.Bool("pod-ips", false, "Compare the IPs assigned to nodes with the IPs of their pods to report idle IPs")
+	kubeconfig = flag.String("kubeconfig", "", "Path to a kubeconfig, the in-cluster config is used when empty")
+
+	cniConfig      capacity.CNIConfig
+	instanceLimits = map[string]capacity.InstanceLimits{}
+	requirementSet []requirements.Requirement
+	subnetPolicy   *policy.Policy
+	notifier       *notify.Notifier
+	sinks          []events.Sink
+	tracker        *events.Tracker
 )
 
-func init() {
+// Parse the flags and register the metrics, kept out of init so tests of the package
+// do not parse the test flags
+func setup() {
 	flag.Parse()
 	utils.SetupLogger(debug)
-	prom.RegisterMetrics()
+	labels, err := prom.ParseConstLabels(*constLabels)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cniConfig = capacity.CNIConfig{
+		Mode:             capacity.Mode(*cniMode),
+		WarmIPTarget:     *cniWarmIPTarget,
+		MinimumIPTarget:  *cniMinimumIPTarget,
+		WarmPrefixTarget: *cniWarmPrefixTarget,
+		MaxPodsPerNode:   *maxPodsPerNode,
+		PodENI:           *cniPodENI,
+		BranchPodRatio:   *cniBranchPodRatio,
+	}
+	if err := cniConfig.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	for _, instanceType := range utils.SplitList(*instanceTypes) {
+		limits, err := capacity.GetInstanceLimits(instanceType)
+		if err != nil {
+			log.Fatal(err)
+		}
+		instanceLimits[instanceType] = limits
+	}
+	extraRequirements, err := requirements.Parse(*serviceRequirements)
+	if err != nil {
+		log.Fatal(err)
+	}
+	requirementSet = requirements.Merge(requirements.Builtin, extraRequirements)
+	if err := prom.RegisterMetrics(prom.Options{
+		Namespace:         *namespace,
+		ConstLabels:       labels,
+		RuntimeCollectors: *runtimeMetrics,
+	}); err != nil {
+		log.Fatal(err)
+	}
 }
 
 func main() {
-	log.WithFields(log.Fields{"port": *port, "region": *region, "filter": *filter, "period": *period, "endpoint": metricsEndpoint}).Info("Starting aws-subnet-exporter")
+	setup()
+	if flag.NArg() > 0 {
+		if err := runCommand(flag.Args()); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	loadServerConfig()
+
+	log.WithFields(log.Fields{"port": *port, "region": *region, "filter": *filter, "period": *period, "endpoint": metricsEndpoint, "namespace": *namespace}).Info("Starting aws-subnet-exporter")
 	client, err := aws.InitEC2Client(*region)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	var kubeClients *kubernetes.Clients
+	if *eniConfig || *podIPs {
+		kubeClients, err = kubernetes.InitClients(*kubeconfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	var eniConfigs *kubernetes.ENIConfigLabeler
+	if *eniConfig {
+		eniConfigs = kubernetes.NewENIConfigLabeler(kubeClients.Dynamic)
+	}
+	var podIPLabeler *kubernetes.PodIPLabeler
+	if *podIPs {
+		podIPLabeler = kubernetes.NewPodIPLabeler(kubeClients.Clientset)
+	}
+
+	store := api.NewStore()
+	var forecaster *forecast.Forecaster
+	if *forecastLookback > 0 {
+		forecaster = forecast.NewForecaster(*forecastLookback)
+	}
+	var notifications chan []aws.Subnet
+	if notifier != nil {
+		notifications = startNotifications(notifier)
+	}
+	var eventQueue chan []events.Event
+	if tracker != nil {
+		eventQueue = startEvents(sinks)
+	}
 	cancel := make(chan struct{})
 
 	ticker := time.NewTicker(*period)
@@ -45,16 +171,54 @@ func main() {
 
 	go func() {
 		for {
+			start := time.Now()
 			subnets, err := aws.GetSubnets(client, *filter)
 			if err != nil {
 				log.Fatal(err)
 			}
-			for _, v := range subnets {
-				prom.AvailableIPs.WithLabelValues(v.VPCID, v.SubnetID, v.CIDRBlock, v.AZ, v.Name).Set(v.AvailableIPs)
-				prom.MaxIPs.WithLabelValues(v.VPCID, v.SubnetID, v.CIDRBlock, v.AZ, v.Name).Set(v.MaxIPs)
-				prom.UsedPrefixes.WithLabelValues(v.VPCID, v.SubnetID, v.CIDRBlock, v.AZ, v.Name).Set(float64(v.UsedPrefixes))
-				prom.AvailablePrefixes.WithLabelValues(v.VPCID, v.SubnetID, v.CIDRBlock, v.AZ, v.Name).Set(float64(len(v.AvailablePrefixes)))
+			if *attributeUsage {
+				if err := aws.AttributeUsage(client, subnets); err != nil {
+					log.WithError(err).Error("Failed to attribute subnet usage")
+				}
+			}
+			if eniConfigs != nil {
+				if err := eniConfigs.Label(context.TODO(), subnets); err != nil {
+					log.WithError(err).Error("Failed to get ENIConfigs, keeping those of the previous refresh")
+				}
+			}
+			if podIPLabeler != nil {
+				if err := podIPLabeler.Label(context.TODO(), subnets); err != nil {
+					log.WithError(err).Warn("Failed to get pod IPs, keeping those of the previous refresh")
+				}
+			}
+			vpcs, vpcErr := aws.GetVPCs(client, aws.VPCIDs(subnets))
+			if vpcErr != nil {
+				log.WithError(vpcErr).Error("Failed to describe VPCs, keeping those of the previous refresh")
+				vpcs = store.Snapshot().VPCs
+			}
+			estimateCapacity(subnets)
+			updateSubnetMetrics(subnets)
+			updateRequirementMetrics(subnets, requirementSet)
+			if subnetPolicy != nil {
+				updatePolicyMetrics(subnets, subnetPolicy)
+			}
+			if forecaster != nil {
+				now := time.Now()
+				forecaster.Record(subnets, now)
+				updateForecastMetrics(subnets, forecaster.Predict(now))
+			}
+			if notifications != nil {
+				queueNotifications(notifications, subnets)
 			}
+			if tracker != nil {
+				queueEvents(eventQueue, tracker.Observe(subnets, time.Now()))
+			}
+			updateAggregateMetrics(subnets, utils.SplitList(*groupTags))
+			if vpcErr == nil {
+				updateVPCMetrics(aggregate.VPCCapacities(vpcs))
+			}
+			store.Update(api.Snapshot{Subnets: subnets, VPCs: vpcs})
+			updateRefreshMetrics(start, time.Now())
 
 			select {
 			case <-ticker.C:
@@ -66,7 +230,110 @@ func main() {
 	}()
 
 	log.WithFields(log.Fields{"endpoint": metricsEndpoint, "port": port}).Info("Starting metrics web server")
-	http.Handle(metricsEndpoint, prom.Handler)
+	http.Handle(metricsEndpoint, prom.Handler())
 	http.Handle(healthEndpoint, http.HandlerFunc(utils.HealthHandler))
+	http.Handle(debugEndpoint, api.DebugSubnetsHandler(store))
+	http.Handle(imbalanceEndpoint, api.ImbalanceHandler(store, utils.SplitList(*groupTags)))
+	http.Handle(adviseEndpoint, api.AdviseHandler(store))
+	http.Handle(subnetsEndpoint, api.SubnetsHandler(store))
+	http.Handle(subnetsEndpoint+"/", api.SubnetsHandler(store))
+	http.Handle(ipEndpoint, api.IPHandler(store))
 	log.Fatal(http.ListenAndServe(":"+*port, nil))
 }
+
+// Load the policy, notifier and event sinks only the exporter uses, so subcommands neither
+// open event files nor fail on their config
+func loadServerConfig() {
+	var err error
+	if *policyFile != "" {
+		subnetPolicy, err = policy.Load(*policyFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *notifyConfig != "" {
+		config, err := notify.Load(*notifyConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+		notifier, err = notify.NewNotifier(config)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	sinks, err = events.ParseSinks(*eventSinks)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(sinks) > 0 {
+		bands, err := events.ParseBands(*utilizationBands)
+		if err != nil {
+			log.Fatal(err)
+		}
+		tracker = events.NewTracker(bands)
+	}
+}
+
+// Fill in the pod capacity and node headroom of every subnet
+func estimateCapacity(subnets []aws.Subnet) {
+	for i := range subnets {
+		subnets[i].PodCapacity = capacity.PodCapacity(subnets[i], cniConfig)
+		subnets[i].NodeHeadroom = map[string]int{}
+		for instanceType, limits := range instanceLimits {
+			subnets[i].NodeHeadroom[instanceType] = capacity.NodeHeadroom(subnets[i], cniConfig, limits)
+		}
+	}
+}
+
+// Check subnets against the notification thresholds in the background, so a slow or
+// hanging webhook does not hold up the refresh loop
+func startNotifications(n *notify.Notifier) chan []aws.Subnet {
+	notifications := make(chan []aws.Subnet, 1)
+	go func() {
+		for subnets := range notifications {
+			n.Notify(context.TODO(), subnets, time.Now())
+		}
+	}()
+	return notifications
+}
+
+// Hand the subnets of a refresh to the notifier, replacing subnets it has not got to
+// yet since only the latest state matters for alerts
+func queueNotifications(notifications chan []aws.Subnet, subnets []aws.Subnet) {
+	select {
+	case <-notifications:
+		log.Warn("Skipping notifications for a previous refresh, webhooks are slow to respond")
+	default:
+	}
+	notifications <- subnets
+}
+
+// Send subnet change events to the sinks in the background, so a slow or hanging
+// webhook does not hold up the refresh loop
+func startEvents(sinks []events.Sink) chan []events.Event {
+	queue := make(chan []events.Event, eventQueueSize)
+	go func() {
+		for evs := range queue {
+			log.WithField("events", len(evs)).Debug("Sending subnet events")
+			for _, sink := range sinks {
+				if err := sink.Send(context.TODO(), evs); err != nil {
+					log.WithError(err).Error("Failed to send subnet events")
+				}
+			}
+		}
+	}()
+	return queue
+}
+
+// Queue the events of a refresh for the sinks, dropping them when the sinks have
+// fallen too far behind
+func queueEvents(queue chan []events.Event, evs []events.Event) {
+	if len(evs) == 0 {
+		return
+	}
+	select {
+	case queue <- evs:
+	default:
+		log.WithField("events", len(evs)).Error("Dropping subnet events, sinks are slow to respond")
+	}
+}
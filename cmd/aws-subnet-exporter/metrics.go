@@ -0,0 +1,204 @@
+package main
+
+import (
+	"time"
+
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/aggregate"
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/aws"
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/forecast"
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/policy"
+	prom "github.com/ministryofjustice/aws-subnet-exporter/pkg/prometheus"
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/requirements"
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+func updateSubnetMetrics(subnets []aws.Subnet) {
+	prom.AvailableIPs.Reset()
+	prom.MaxIPs.Reset()
+	prom.UsedPrefixes.Reset()
+	prom.AvailablePrefixes.Reset()
+	prom.MaxPrefixes.Reset()
+	prom.AllocatedIPs.Reset()
+	prom.FreeIPs.Reset()
+	prom.InterfacesInUse.Reset()
+	prom.TrunkInterfaces.Reset()
+	prom.BranchInterfaces.Reset()
+	prom.BranchIPs.Reset()
+	prom.UtilizationRatio.Reset()
+	prom.AvailableIPsDiscrepancy.Reset()
+	prom.ReservedAvailablePrefixes.Reset()
+	prom.UnreservedAvailablePrefixes.Reset()
+	prom.ExplicitReservedIPs.Reset()
+	prom.PodCapacity.Reset()
+	prom.NodeHeadroom.Reset()
+	prom.AttributedIPs.Reset()
+	prom.AttributedPrefixes.Reset()
+	prom.MinFreeIPsThreshold.Reset()
+	prom.MinFreePrefixesThreshold.Reset()
+	prom.ENIConfigInfo.Reset()
+	prom.PodIPs.Reset()
+	prom.IdleIPs.Reset()
+	prom.NodeIdleIPs.Reset()
+	for _, v := range subnets {
+		labelValues := []string{v.VPCID, v.SubnetID, v.CIDRBlock, v.AZ, v.Name}
+		prom.AvailableIPs.WithLabelValues(labelValues...).Set(v.AvailableIPs)
+		prom.MaxIPs.WithLabelValues(labelValues...).Set(v.MaxIPs)
+		prom.UsedPrefixes.WithLabelValues(labelValues...).Set(float64(v.UsedPrefixes))
+		prom.AvailablePrefixes.WithLabelValues(labelValues...).Set(float64(len(v.AvailablePrefixes)))
+		prom.MaxPrefixes.WithLabelValues(labelValues...).Set(float64(v.MaxPrefixes))
+		prom.AllocatedIPs.WithLabelValues(labelValues...).Set(float64(v.AllocatedIPs))
+		prom.FreeIPs.WithLabelValues(labelValues...).Set(float64(v.FreeIPs))
+		prom.InterfacesInUse.WithLabelValues(labelValues...).Set(float64(v.InterfacesInUse))
+		prom.TrunkInterfaces.WithLabelValues(labelValues...).Set(float64(v.TrunkInterfaces))
+		prom.BranchInterfaces.WithLabelValues(labelValues...).Set(float64(v.BranchInterfaces))
+		prom.BranchIPs.WithLabelValues(labelValues...).Set(float64(v.BranchIPs))
+		prom.UtilizationRatio.WithLabelValues(labelValues...).Set(v.UtilizationRatio())
+		prom.AvailableIPsDiscrepancy.WithLabelValues(labelValues...).Set(float64(v.AvailableIPsDiscrepancy()))
+		prom.ReservedAvailablePrefixes.WithLabelValues(labelValues...).Set(float64(v.ReservedAvailablePrefixes))
+		prom.UnreservedAvailablePrefixes.WithLabelValues(labelValues...).Set(float64(v.UnreservedAvailablePrefixes))
+		prom.ExplicitReservedIPs.WithLabelValues(labelValues...).Set(float64(v.ExplicitReservedIPs))
+		prom.PodCapacity.WithLabelValues(labelValues...).Set(float64(v.PodCapacity))
+		for instanceType, headroom := range v.NodeHeadroom {
+			prom.NodeHeadroom.WithLabelValues(append(labelValues, instanceType)...).Set(float64(headroom))
+		}
+		for _, a := range v.Usage {
+			prom.AttributedIPs.WithLabelValues(append(labelValues, a.Cluster, a.NodeGroup)...).Set(float64(a.IPs))
+			prom.AttributedPrefixes.WithLabelValues(append(labelValues, a.Cluster, a.NodeGroup)...).Set(float64(a.Prefixes))
+		}
+		if v.Thresholds.MinFreeIPs != nil {
+			prom.MinFreeIPsThreshold.WithLabelValues(labelValues...).Set(float64(*v.Thresholds.MinFreeIPs))
+		}
+		if v.Thresholds.MinFreePrefixes != nil {
+			prom.MinFreePrefixesThreshold.WithLabelValues(labelValues...).Set(float64(*v.Thresholds.MinFreePrefixes))
+		}
+		for _, name := range v.ENIConfigs {
+			prom.ENIConfigInfo.WithLabelValues(append(labelValues, name)...).Set(1)
+		}
+		if v.NodeIPs != nil {
+			prom.PodIPs.WithLabelValues(labelValues...).Set(float64(v.PodIPs()))
+			prom.IdleIPs.WithLabelValues(labelValues...).Set(float64(v.IdleIPs()))
+		}
+		for _, n := range v.NodeIPs {
+			prom.NodeIdleIPs.WithLabelValues(append(labelValues, n.Node)...).Set(float64(n.IdleIPs()))
+		}
+	}
+}
+
+func updateRequirementMetrics(subnets []aws.Subnet, reqs []requirements.Requirement) {
+	prom.RequirementSatisfied.Reset()
+	prom.RequirementMinFreeIPs.Reset()
+	for _, v := range subnets {
+		labelValues := []string{v.VPCID, v.SubnetID, v.CIDRBlock, v.AZ, v.Name}
+		for _, r := range requirements.Evaluate(v, reqs) {
+			satisfied := 0.0
+			if r.Satisfied() {
+				satisfied = 1
+			}
+			prom.RequirementSatisfied.WithLabelValues(append(labelValues, r.Requirement.Name)...).Set(satisfied)
+			prom.RequirementMinFreeIPs.WithLabelValues(append(labelValues, r.Requirement.Name)...).Set(float64(r.Requirement.MinFreeIPs))
+		}
+	}
+}
+
+func updatePolicyMetrics(subnets []aws.Subnet, p *policy.Policy) {
+	prom.PolicyViolation.Reset()
+	for _, v := range subnets {
+		labelValues := []string{v.VPCID, v.SubnetID, v.CIDRBlock, v.AZ, v.Name}
+		for _, r := range p.Evaluate(v) {
+			if r.Err != nil {
+				log.WithError(r.Err).Warn("Skipping policy rule")
+				continue
+			}
+			violated := 0.0
+			if r.Violated {
+				violated = 1
+			}
+			prom.PolicyViolation.WithLabelValues(append(labelValues, r.Rule.Name)...).Set(violated)
+		}
+	}
+}
+
+func updateForecastMetrics(subnets []aws.Subnet, predictions []forecast.Prediction) {
+	prom.PredictedExhaustionSeconds.Reset()
+	bySubnetID := make(map[string]aws.Subnet, len(subnets))
+	for _, v := range subnets {
+		bySubnetID[v.SubnetID] = v
+	}
+	for _, p := range predictions {
+		v := bySubnetID[p.SubnetID]
+		prom.PredictedExhaustionSeconds.WithLabelValues(v.VPCID, v.SubnetID, v.CIDRBlock, v.AZ, v.Name, p.Resource).Set(p.Exhaustion.Seconds())
+	}
+}
+
+func updateRefreshMetrics(start, end time.Time) {
+	prom.LastRefreshTimestamp.Set(float64(end.Unix()))
+	prom.RefreshDuration.Set(end.Sub(start).Seconds())
+}
+
+func updateAggregateMetrics(subnets []aws.Subnet, groupTags []string) {
+	setAggregates(prom.VPCAggregates, aggregate.ByVPC(subnets), func(a aggregate.Aggregate) []string {
+		return []string{a.VPCID}
+	})
+	setAggregates(prom.AZAggregates, aggregate.ByAZ(subnets), func(a aggregate.Aggregate) []string {
+		return []string{a.VPCID, a.AZ}
+	})
+
+	var groups []aggregate.Aggregate
+	for _, tag := range groupTags {
+		groups = append(groups, aggregate.ByTag(subnets, tag)...)
+	}
+	setAggregates(prom.GroupAggregates, groups, func(a aggregate.Aggregate) []string {
+		return []string{a.VPCID, a.GroupTag, a.GroupValue, a.AZ}
+	})
+
+	setImbalances(prom.VPCImbalance, aggregate.VPCImbalances(subnets), func(i aggregate.Imbalance) []string {
+		return []string{i.VPCID}
+	})
+	var groupImbalances []aggregate.Imbalance
+	for _, tag := range groupTags {
+		groupImbalances = append(groupImbalances, aggregate.TagImbalances(subnets, tag)...)
+	}
+	setImbalances(prom.GroupImbalance, groupImbalances, func(i aggregate.Imbalance) []string {
+		return []string{i.VPCID, i.GroupTag, i.GroupValue}
+	})
+}
+
+func updateVPCMetrics(capacities []aggregate.VPCCapacity) {
+	prom.VPCCIDRIPs.Reset()
+	prom.VPCUnallocatedIPs.Reset()
+	prom.VPCLargestFreeBlockIPs.Reset()
+	prom.VPCLargestFreeBlockPrefixLength.Reset()
+	for _, c := range capacities {
+		prom.VPCCIDRIPs.WithLabelValues(c.VPCID).Set(float64(c.TotalIPs))
+		prom.VPCUnallocatedIPs.WithLabelValues(c.VPCID).Set(float64(c.UnallocatedIPs()))
+		if block, ok := c.LargestFreeBlock(); ok {
+			prom.VPCLargestFreeBlockIPs.WithLabelValues(c.VPCID).Set(float64(utils.PrefixSize(block)))
+			prom.VPCLargestFreeBlockPrefixLength.WithLabelValues(c.VPCID).Set(float64(block.Bits()))
+		} else {
+			prom.VPCLargestFreeBlockIPs.WithLabelValues(c.VPCID).Set(0)
+		}
+	}
+}
+
+func setAggregates(gauges prom.AggregateGauges, aggregates []aggregate.Aggregate, labelValues func(aggregate.Aggregate) []string) {
+	gauges.Reset()
+	for _, a := range aggregates {
+		values := labelValues(a)
+		gauges.Subnets.WithLabelValues(values...).Set(float64(a.Subnets))
+		gauges.TotalIPs.WithLabelValues(values...).Set(float64(a.TotalIPs))
+		gauges.AvailableIPs.WithLabelValues(values...).Set(float64(a.AvailableIPs))
+		gauges.FreeIPs.WithLabelValues(values...).Set(float64(a.FreeIPs))
+		gauges.AvailablePrefixes.WithLabelValues(values...).Set(float64(a.AvailablePrefixes))
+		gauges.PodCapacity.WithLabelValues(values...).Set(float64(a.PodCapacity))
+	}
+}
+
+func setImbalances(gauges prom.ImbalanceGauges, imbalances []aggregate.Imbalance, labelValues func(aggregate.Imbalance) []string) {
+	gauges.Reset()
+	for _, i := range imbalances {
+		values := labelValues(i)
+		gauges.FreeIPsSkew.WithLabelValues(values...).Set(float64(i.FreeIPsSkew()))
+		gauges.FreePrefixesSkew.WithLabelValues(values...).Set(float64(i.FreePrefixesSkew()))
+	}
+}
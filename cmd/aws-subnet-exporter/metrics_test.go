@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/aws"
+	prom "github.com/ministryofjustice/aws-subnet-exporter/pkg/prometheus"
+)
+
+func TestUpdateSubnetMetricsDropsDeletedSubnets(t *testing.T) {
+	if err := prom.RegisterMetrics(prom.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	updateSubnetMetrics([]aws.Subnet{
+		{SubnetID: "subnet-1", NodeHeadroom: map[string]int{"m5.large": 1}},
+		{SubnetID: "subnet-2", NodeHeadroom: map[string]int{"m5.large": 1}},
+	})
+	updateSubnetMetrics([]aws.Subnet{
+		{SubnetID: "subnet-1", NodeHeadroom: map[string]int{"m5.large": 1}},
+	})
+
+	families, err := prom.Registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "subnetid" && l.GetValue() == "subnet-2" {
+					t.Errorf("%s still exports deleted subnet-2", family.GetName())
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package aggregate
+
+import (
+	"sort"
+
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/aws"
+)
+
+// Key identifying a group of subnets. Fields that do not apply to the grouping are left empty.
+type Key struct {
+	VPCID      string
+	AZ         string
+	GroupTag   string
+	GroupValue string
+}
+
+// Capacity of a group of subnets, summed from the per subnet numbers
+type Aggregate struct {
+	Key
+	Subnets           int
+	TotalIPs          int
+	AvailableIPs      int
+	FreeIPs           int
+	AllocatedIPs      int
+	UsedPrefixes      int
+	AvailablePrefixes int
+	PodCapacity       int
+}
+
+func (a *Aggregate) add(s aws.Subnet) {
+	a.Subnets++
+	a.TotalIPs += s.TotalIPs
+	a.AvailableIPs += int(s.AvailableIPs)
+	a.FreeIPs += s.FreeIPs
+	a.AllocatedIPs += s.AllocatedIPs
+	a.UsedPrefixes += s.UsedPrefixes
+	a.AvailablePrefixes += len(s.AvailablePrefixes)
+	a.PodCapacity += s.PodCapacity
+}
+
+// Aggregate subnets per VPC
+func ByVPC(subnets []aws.Subnet) []Aggregate {
+	return group(subnets, func(s aws.Subnet) (Key, bool) {
+		return Key{VPCID: s.VPCID}, true
+	})
+}
+
+// Aggregate subnets per availability zone within each VPC
+func ByAZ(subnets []aws.Subnet) []Aggregate {
+	return group(subnets, func(s aws.Subnet) (Key, bool) {
+		return Key{VPCID: s.VPCID, AZ: s.AZ}, true
+	})
+}
+
+// Aggregate subnets per VPC, value of the tag and availability zone, subnets without the tag are skipped
+func ByTag(subnets []aws.Subnet, tag string) []Aggregate {
+	return group(subnets, func(s aws.Subnet) (Key, bool) {
+		value, ok := s.Tags[tag]
+		if !ok {
+			return Key{}, false
+		}
+		return Key{VPCID: s.VPCID, AZ: s.AZ, GroupTag: tag, GroupValue: value}, true
+	})
+}
+
+func group(subnets []aws.Subnet, keyFn func(aws.Subnet) (Key, bool)) []Aggregate {
+	groups := map[Key]*Aggregate{}
+	for _, s := range subnets {
+		key, ok := keyFn(s)
+		if !ok {
+			continue
+		}
+		if _, ok := groups[key]; !ok {
+			groups[key] = &Aggregate{Key: key}
+		}
+		groups[key].add(s)
+	}
+
+	aggregates := make([]Aggregate, 0, len(groups))
+	for _, a := range groups {
+		aggregates = append(aggregates, *a)
+	}
+	sort.Slice(aggregates, func(i, j int) bool {
+		return aggregates[i].Key.less(aggregates[j].Key)
+	})
+	return aggregates
+}
+
+func (k Key) less(o Key) bool {
+	if k.VPCID != o.VPCID {
+		return k.VPCID < o.VPCID
+	}
+	if k.GroupTag != o.GroupTag {
+		return k.GroupTag < o.GroupTag
+	}
+	if k.GroupValue != o.GroupValue {
+		return k.GroupValue < o.GroupValue
+	}
+	return k.AZ < o.AZ
+}
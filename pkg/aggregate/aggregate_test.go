@@ -0,0 +1,65 @@
+package aggregate
+
+import (
+	"testing"
+
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/aws"
+)
+
+var testSubnets = []aws.Subnet{
+	{SubnetID: "subnet-1", VPCID: "vpc-1", AZ: "eu-west-2a", Tags: map[string]string{"tier": "private"}, TotalIPs: 256, FreeIPs: 100, AvailablePrefixes: []string{"a", "b"}},
+	{SubnetID: "subnet-2", VPCID: "vpc-1", AZ: "eu-west-2a", Tags: map[string]string{"tier": "public"}, TotalIPs: 256, FreeIPs: 50, AvailablePrefixes: []string{"c"}},
+	{SubnetID: "subnet-3", VPCID: "vpc-1", AZ: "eu-west-2b", Tags: map[string]string{"tier": "private"}, TotalIPs: 256, FreeIPs: 20},
+	{SubnetID: "subnet-4", VPCID: "vpc-2", AZ: "eu-west-2a", TotalIPs: 64, FreeIPs: 10},
+	{SubnetID: "subnet-5", VPCID: "vpc-2", AZ: "eu-west-2b", Tags: map[string]string{"tier": "private"}, TotalIPs: 64, FreeIPs: 30},
+}
+
+func TestAggregates(t *testing.T) {
+	tests := []struct {
+		name string
+		got  []Aggregate
+		want []Aggregate
+	}{
+		{
+			name: "By VPC",
+			got:  ByVPC(testSubnets),
+			want: []Aggregate{
+				{Key: Key{VPCID: "vpc-1"}, Subnets: 3, TotalIPs: 768, FreeIPs: 170, AvailablePrefixes: 3},
+				{Key: Key{VPCID: "vpc-2"}, Subnets: 2, TotalIPs: 128, FreeIPs: 40},
+			},
+		},
+		{
+			name: "By AZ",
+			got:  ByAZ(testSubnets),
+			want: []Aggregate{
+				{Key: Key{VPCID: "vpc-1", AZ: "eu-west-2a"}, Subnets: 2, TotalIPs: 512, FreeIPs: 150, AvailablePrefixes: 3},
+				{Key: Key{VPCID: "vpc-1", AZ: "eu-west-2b"}, Subnets: 1, TotalIPs: 256, FreeIPs: 20},
+				{Key: Key{VPCID: "vpc-2", AZ: "eu-west-2a"}, Subnets: 1, TotalIPs: 64, FreeIPs: 10},
+				{Key: Key{VPCID: "vpc-2", AZ: "eu-west-2b"}, Subnets: 1, TotalIPs: 64, FreeIPs: 30},
+			},
+		},
+		{
+			name: "By tag skips untagged subnets and keeps VPCs apart",
+			got:  ByTag(testSubnets, "tier"),
+			want: []Aggregate{
+				{Key: Key{VPCID: "vpc-1", AZ: "eu-west-2a", GroupTag: "tier", GroupValue: "private"}, Subnets: 1, TotalIPs: 256, FreeIPs: 100, AvailablePrefixes: 2},
+				{Key: Key{VPCID: "vpc-1", AZ: "eu-west-2b", GroupTag: "tier", GroupValue: "private"}, Subnets: 1, TotalIPs: 256, FreeIPs: 20},
+				{Key: Key{VPCID: "vpc-1", AZ: "eu-west-2a", GroupTag: "tier", GroupValue: "public"}, Subnets: 1, TotalIPs: 256, FreeIPs: 50, AvailablePrefixes: 1},
+				{Key: Key{VPCID: "vpc-2", AZ: "eu-west-2b", GroupTag: "tier", GroupValue: "private"}, Subnets: 1, TotalIPs: 64, FreeIPs: 30},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if len(tt.got) != len(tt.want) {
+				t.Fatalf("got %d aggregates, want %d: %+v", len(tt.got), len(tt.want), tt.got)
+			}
+			for i := range tt.want {
+				if tt.got[i] != tt.want[i] {
+					t.Errorf("aggregate %d = %+v, want %+v", i, tt.got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package aggregate
+
+import (
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/aws"
+)
+
+// Spread of free capacity across the availability zones of a group of subnets
+type Imbalance struct {
+	// Group the availability zones belong to, AZ is always empty
+	Key
+	AZs int
+	// Availability zone with the fewest free IPs, ties are broken by the fewest free prefixes
+	FirstToRunOut   string
+	MinFreeIPs      int
+	MaxFreeIPs      int
+	MinFreePrefixes int
+	MaxFreePrefixes int
+}
+
+// Free IPs in the emptiest availability zone minus free IPs in the fullest
+func (i Imbalance) FreeIPsSkew() int {
+	return i.MaxFreeIPs - i.MinFreeIPs
+}
+
+// Free prefixes in the emptiest availability zone minus free prefixes in the fullest
+func (i Imbalance) FreePrefixesSkew() int {
+	return i.MaxFreePrefixes - i.MinFreePrefixes
+}
+
+// Imbalance between the availability zones of each VPC
+func VPCImbalances(subnets []aws.Subnet) []Imbalance {
+	return imbalances(ByAZ(subnets))
+}
+
+// Imbalance between the availability zones of each value of the tag within each VPC
+func TagImbalances(subnets []aws.Subnet, tag string) []Imbalance {
+	return imbalances(ByTag(subnets, tag))
+}
+
+// Fold per availability zone aggregates into one imbalance per group. The aggregates
+// are sorted by group first, so availability zones of a group are adjacent.
+func imbalances(azAggregates []Aggregate) []Imbalance {
+	var result []Imbalance
+	for _, a := range azAggregates {
+		groupKey := a.Key
+		groupKey.AZ = ""
+		if len(result) == 0 || result[len(result)-1].Key != groupKey {
+			result = append(result, Imbalance{
+				Key:             groupKey,
+				FirstToRunOut:   a.AZ,
+				MinFreeIPs:      a.FreeIPs,
+				MaxFreeIPs:      a.FreeIPs,
+				MinFreePrefixes: a.AvailablePrefixes,
+				MaxFreePrefixes: a.AvailablePrefixes,
+			})
+		}
+		i := &result[len(result)-1]
+		i.AZs++
+		if a.FreeIPs < i.MinFreeIPs || (a.FreeIPs == i.MinFreeIPs && a.AvailablePrefixes < i.MinFreePrefixes) {
+			i.FirstToRunOut = a.AZ
+		}
+		if a.FreeIPs < i.MinFreeIPs {
+			i.MinFreeIPs = a.FreeIPs
+		}
+		if a.FreeIPs > i.MaxFreeIPs {
+			i.MaxFreeIPs = a.FreeIPs
+		}
+		if a.AvailablePrefixes < i.MinFreePrefixes {
+			i.MinFreePrefixes = a.AvailablePrefixes
+		}
+		if a.AvailablePrefixes > i.MaxFreePrefixes {
+			i.MaxFreePrefixes = a.AvailablePrefixes
+		}
+	}
+	return result
+}
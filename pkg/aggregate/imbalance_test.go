@@ -0,0 +1,44 @@
+package aggregate
+
+import (
+	"testing"
+)
+
+func TestImbalances(t *testing.T) {
+	tests := []struct {
+		name string
+		got  []Imbalance
+		want []Imbalance
+	}{
+		{
+			name: "Per VPC",
+			got:  VPCImbalances(testSubnets),
+			want: []Imbalance{
+				{Key: Key{VPCID: "vpc-1"}, AZs: 2, FirstToRunOut: "eu-west-2b", MinFreeIPs: 20, MaxFreeIPs: 150, MinFreePrefixes: 0, MaxFreePrefixes: 3},
+				{Key: Key{VPCID: "vpc-2"}, AZs: 2, FirstToRunOut: "eu-west-2a", MinFreeIPs: 10, MaxFreeIPs: 30},
+			},
+		},
+		{
+			name: "Per tag group",
+			got:  TagImbalances(testSubnets, "tier"),
+			want: []Imbalance{
+				{Key: Key{VPCID: "vpc-1", GroupTag: "tier", GroupValue: "private"}, AZs: 2, FirstToRunOut: "eu-west-2b", MinFreeIPs: 20, MaxFreeIPs: 100, MinFreePrefixes: 0, MaxFreePrefixes: 2},
+				{Key: Key{VPCID: "vpc-1", GroupTag: "tier", GroupValue: "public"}, AZs: 1, FirstToRunOut: "eu-west-2a", MinFreeIPs: 50, MaxFreeIPs: 50, MinFreePrefixes: 1, MaxFreePrefixes: 1},
+				{Key: Key{VPCID: "vpc-2", GroupTag: "tier", GroupValue: "private"}, AZs: 1, FirstToRunOut: "eu-west-2b", MinFreeIPs: 30, MaxFreeIPs: 30},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if len(tt.got) != len(tt.want) {
+				t.Fatalf("got %d imbalances, want %d: %+v", len(tt.got), len(tt.want), tt.got)
+			}
+			for i := range tt.want {
+				if tt.got[i] != tt.want[i] {
+					t.Errorf("imbalance %d = %+v, want %+v", i, tt.got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
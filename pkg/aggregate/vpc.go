@@ -0,0 +1,114 @@
+package aggregate
+
+import (
+	"fmt"
+	"net/netip"
+
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/aws"
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// Address space of a VPC and how much of it is left for new subnets
+type VPCCapacity struct {
+	VPCID string
+	Name  string
+	// Addresses in the primary and secondary CIDR blocks of the VPC
+	TotalIPs int
+	// Addresses in the CIDR blocks of subnets in the VPC
+	SubnetIPs int
+	// Largest aligned blocks not overlapping any subnet, sorted by address
+	FreeBlocks []netip.Prefix
+}
+
+// Addresses in the VPC not allocated to any subnet
+func (c VPCCapacity) UnallocatedIPs() int {
+	return c.TotalIPs - c.SubnetIPs
+}
+
+// Largest free aligned block where a new subnet could go, blocks smaller than the
+// smallest subnet AWS allows do not count
+func (c VPCCapacity) LargestFreeBlock() (netip.Prefix, bool) {
+	return utils.LargestBlock(c.FreeBlocks, MaxSubnetPrefixLength)
+}
+
+// Work out the free address space of each VPC from its CIDR blocks and every subnet in it
+func VPCCapacities(vpcs []aws.VPC) []VPCCapacity {
+	var capacities []VPCCapacity
+	for _, v := range vpcs {
+		c, err := vpcCapacity(v, v.SubnetCIDRBlocks())
+		if err != nil {
+			log.WithError(err).WithField("vpcid", v.VPCID).Warn("Unable to compute VPC capacity")
+			continue
+		}
+		capacities = append(capacities, c)
+	}
+	return capacities
+}
+
+func vpcCapacity(v aws.VPC, subnetCIDRs []string) (VPCCapacity, error) {
+	space, err := utils.ParsePrefixes(v.CIDRBlocks)
+	if err != nil {
+		return VPCCapacity{}, err
+	}
+	used, err := utils.ParsePrefixes(subnetCIDRs)
+	if err != nil {
+		return VPCCapacity{}, err
+	}
+
+	c := VPCCapacity{VPCID: v.VPCID, Name: v.Name}
+	for _, p := range space {
+		c.TotalIPs += utils.PrefixSize(p)
+	}
+	for _, p := range used {
+		c.SubnetIPs += utils.PrefixSize(p)
+	}
+	c.FreeBlocks = utils.FreeBlocks(space, used)
+	return c, nil
+}
+
+const (
+	// Smallest and largest prefix lengths AWS allows for IPv4 subnets
+	MinSubnetPrefixLength = 16
+	MaxSubnetPrefixLength = 28
+
+	// Candidates considered when ordering suggestions by availability zone
+	maxCandidates = 1024
+)
+
+// Suggest up to count CIDR blocks for a new subnet in the VPC that do not overlap any
+// existing subnet. Subnet CIDR reservations always sit inside a subnet, so they are
+// excluded along with it. When az is set, blocks closest to the existing subnets in
+// that availability zone come first.
+func SuggestSubnetCIDRs(vpc aws.VPC, prefixLength int, az string, count int) ([]netip.Prefix, error) {
+	if prefixLength < MinSubnetPrefixLength || prefixLength > MaxSubnetPrefixLength {
+		return nil, fmt.Errorf("prefix length must be between %d and %d", MinSubnetPrefixLength, MaxSubnetPrefixLength)
+	}
+	if count < 1 {
+		return nil, fmt.Errorf("count must be at least 1")
+	}
+	c, err := vpcCapacity(vpc, vpc.SubnetCIDRBlocks())
+	if err != nil {
+		return nil, err
+	}
+	if az == "" {
+		return utils.SuggestCIDRs(c.FreeBlocks, prefixLength, count), nil
+	}
+
+	var azCIDRs []string
+	for _, s := range vpc.Subnets {
+		if s.AZ == az {
+			azCIDRs = append(azCIDRs, s.CIDRBlock)
+		}
+	}
+	anchors, err := utils.ParsePrefixes(azCIDRs)
+	if err != nil {
+		return nil, err
+	}
+	suggestions := utils.SuggestCIDRs(c.FreeBlocks, prefixLength, maxCandidates)
+	utils.SortByProximity(suggestions, anchors)
+	if len(suggestions) > count {
+		suggestions = suggestions[:count]
+	}
+	return suggestions, nil
+}
@@ -0,0 +1,108 @@
+package aggregate
+
+import (
+	"testing"
+
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/aws"
+)
+
+var testVPC = aws.VPC{
+	VPCID:      "vpc-1",
+	CIDRBlocks: []string{"10.0.0.0/20"},
+	Subnets: []aws.SubnetCIDR{
+		{SubnetID: "subnet-1", AZ: "eu-west-2a", CIDRBlock: "10.0.0.0/24"},
+		{SubnetID: "subnet-2", AZ: "eu-west-2b", CIDRBlock: "10.0.8.0/24"},
+	},
+}
+
+func TestVPCCapacities(t *testing.T) {
+	got := VPCCapacities([]aws.VPC{testVPC})
+	if len(got) != 1 {
+		t.Fatalf("VPCCapacities() returned %d capacities, want 1", len(got))
+	}
+	if got[0].TotalIPs != 4096 || got[0].UnallocatedIPs() != 3584 {
+		t.Errorf("VPCCapacities() total = %v, unallocated = %v, want 4096, 3584", got[0].TotalIPs, got[0].UnallocatedIPs())
+	}
+	largest, ok := got[0].LargestFreeBlock()
+	if !ok || largest.String() != "10.0.4.0/22" {
+		t.Errorf("LargestFreeBlock() = %v, want 10.0.4.0/22", largest)
+	}
+}
+
+func TestVPCCapacitiesNoRoomForASubnet(t *testing.T) {
+	vpc := aws.VPC{
+		VPCID:      "vpc-1",
+		CIDRBlocks: []string{"10.0.0.0/24"},
+		Subnets: []aws.SubnetCIDR{
+			{SubnetID: "subnet-1", CIDRBlock: "10.0.0.0/25"},
+			{SubnetID: "subnet-2", CIDRBlock: "10.0.0.128/26"},
+			{SubnetID: "subnet-3", CIDRBlock: "10.0.0.192/27"},
+			{SubnetID: "subnet-4", CIDRBlock: "10.0.0.224/28"},
+			{SubnetID: "subnet-5", CIDRBlock: "10.0.0.240/29"},
+		},
+	}
+	got := VPCCapacities([]aws.VPC{vpc})
+	if len(got) != 1 || got[0].UnallocatedIPs() != 8 {
+		t.Fatalf("VPCCapacities() = %+v, want 8 unallocated IPs", got)
+	}
+	if largest, ok := got[0].LargestFreeBlock(); ok {
+		t.Errorf("LargestFreeBlock() = %v, want none as only a /29 is free", largest)
+	}
+}
+
+func TestSuggestSubnetCIDRs(t *testing.T) {
+	tests := []struct {
+		name         string
+		prefixLength int
+		az           string
+		count        int
+		want         []string
+		expectErr    bool
+	}{
+		{
+			name:         "Smallest free blocks first",
+			prefixLength: 24,
+			count:        3,
+			want:         []string{"10.0.1.0/24", "10.0.9.0/24", "10.0.2.0/24"},
+		},
+		{
+			name:         "Next to the subnets of an availability zone",
+			prefixLength: 24,
+			az:           "eu-west-2b",
+			count:        2,
+			want:         []string{"10.0.9.0/24", "10.0.7.0/24"},
+		},
+		{
+			name:         "No block large enough",
+			prefixLength: 16,
+			count:        1,
+			want:         []string{},
+		},
+		{
+			name:         "Prefix length out of range",
+			prefixLength: 29,
+			count:        1,
+			expectErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SuggestSubnetCIDRs(testVPC, tt.prefixLength, tt.az, tt.count)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("SuggestSubnetCIDRs() error = %v, expectErr %v", err, tt.expectErr)
+			}
+			if tt.expectErr {
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("SuggestSubnetCIDRs() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i].String() != tt.want[i] {
+					t.Errorf("SuggestSubnetCIDRs() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
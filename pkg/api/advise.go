@@ -0,0 +1,59 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/aggregate"
+)
+
+const defaultSuggestions = 5
+
+type adviseResponse struct {
+	VPCID        string   `json:"vpcId"`
+	PrefixLength int      `json:"prefixLength"`
+	AZ           string   `json:"az,omitempty"`
+	Candidates   []string `json:"candidates"`
+}
+
+// Suggest CIDR blocks for a new subnet, e.g. /api/v1/advise?vpc=vpc-123&prefix-length=24&az=eu-west-2a&count=5
+func AdviseHandler(store *Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		vpcID := query.Get("vpc")
+		if vpcID == "" {
+			writeError(w, http.StatusBadRequest, "vpc is required")
+			return
+		}
+		prefixLength, err := strconv.Atoi(query.Get("prefix-length"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "prefix-length must be a number")
+			return
+		}
+		count := defaultSuggestions
+		if query.Get("count") != "" {
+			if count, err = strconv.Atoi(query.Get("count")); err != nil {
+				writeError(w, http.StatusBadRequest, "count must be a number")
+				return
+			}
+		}
+
+		for _, vpc := range store.Snapshot().VPCs {
+			if vpc.VPCID != vpcID {
+				continue
+			}
+			suggestions, err := aggregate.SuggestSubnetCIDRs(vpc, prefixLength, query.Get("az"), count)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			resp := adviseResponse{VPCID: vpcID, PrefixLength: prefixLength, AZ: query.Get("az"), Candidates: []string{}}
+			for _, s := range suggestions {
+				resp.Candidates = append(resp.Candidates, s.String())
+			}
+			writeJSON(w, http.StatusOK, resp)
+			return
+		}
+		writeError(w, http.StatusNotFound, "VPC not found: "+vpcID)
+	}
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/aws"
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/utils"
+)
+
+// Breakdown of how the computed free IPs of a subnet compare to the free IPs reported by AWS
+type SubnetBreakdown struct {
+	SubnetID        string `json:"subnetId"`
+	Name            string `json:"name"`
+	VPCID           string `json:"vpcId"`
+	AZ              string `json:"az"`
+	CIDRBlock       string `json:"cidrBlock"`
+	TotalIPs        int    `json:"totalIps"`
+	ReservedIPs     int    `json:"reservedIps"`
+	InterfacesInUse int    `json:"interfacesInUse"`
+	InterfaceIPs    int    `json:"interfaceIps"`
+	PrefixesInUse   int    `json:"prefixesInUse"`
+	PrefixIPs       int    `json:"prefixIps"`
+	// IPs of explicit reservations that no network interface uses, counted as allocated
+	ExplicitReservedUnusedIPs int `json:"explicitReservedUnusedIps"`
+	AllocatedIPs              int `json:"allocatedIps"`
+	ComputedFreeIPs           int `json:"computedFreeIps"`
+	ReportedFreeIPs           int `json:"reportedFreeIps"`
+	FreeIPsDiscrepancy        int `json:"freeIpsDiscrepancy"`
+}
+
+type debugSubnetsResponse struct {
+	Updated time.Time         `json:"updated"`
+	Subnets []SubnetBreakdown `json:"subnets"`
+}
+
+func NewSubnetBreakdown(s aws.Subnet) SubnetBreakdown {
+	return SubnetBreakdown{
+		SubnetID:                  s.SubnetID,
+		Name:                      s.Name,
+		VPCID:                     s.VPCID,
+		AZ:                        s.AZ,
+		CIDRBlock:                 s.CIDRBlock,
+		TotalIPs:                  s.TotalIPs,
+		ReservedIPs:               utils.AWSReservedIPs,
+		InterfacesInUse:           s.InterfacesInUse,
+		InterfaceIPs:              s.InterfaceIPs,
+		PrefixesInUse:             s.UsedPrefixes,
+		PrefixIPs:                 s.UsedPrefixes * utils.IPsPerPrefix,
+		ExplicitReservedUnusedIPs: s.ExplicitReservedUnusedIPs,
+		AllocatedIPs:              s.AllocatedIPs,
+		ComputedFreeIPs:           s.FreeIPs,
+		ReportedFreeIPs:           int(s.AvailableIPs),
+		FreeIPsDiscrepancy:        s.AvailableIPsDiscrepancy(),
+	}
+}
+
+// Serve the per subnet breakdown of reported versus computed free IPs from the latest snapshot
+func DebugSubnetsHandler(store *Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		snapshot := store.Snapshot()
+		resp := debugSubnetsResponse{Updated: snapshot.Updated, Subnets: []SubnetBreakdown{}}
+		for _, s := range snapshot.Subnets {
+			resp.Subnets = append(resp.Subnets, NewSubnetBreakdown(s))
+		}
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
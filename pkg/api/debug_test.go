@@ -0,0 +1,52 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/aws"
+)
+
+func TestDebugSubnetsHandler(t *testing.T) {
+	store := NewStore()
+	store.Update(Snapshot{Subnets: []aws.Subnet{
+		{
+			SubnetID:     "subnet-1",
+			CIDRBlock:    "172.16.1.0/24",
+			AvailableIPs: 200,
+			TotalIPs:     256,
+			InterfaceIPs: 3,
+			UsedPrefixes: 2,
+			// 3 interface IPs, 2 prefixes, the AWS reserved IPs and 7 unused explicitly reserved IPs
+			ExplicitReservedUnusedIPs: 7,
+			AllocatedIPs:              47,
+			FreeIPs:                   209,
+		},
+	}})
+
+	rec := httptest.NewRecorder()
+	DebugSubnetsHandler(store)(rec, httptest.NewRequest(http.MethodGet, "/debug/subnets", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("DebugSubnetsHandler() status = %v, want %v", rec.Code, http.StatusOK)
+	}
+	var resp debugSubnetsResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("DebugSubnetsHandler() returned invalid JSON: %v", err)
+	}
+	if len(resp.Subnets) != 1 {
+		t.Fatalf("DebugSubnetsHandler() returned %d subnets, want 1", len(resp.Subnets))
+	}
+	got := resp.Subnets[0]
+	if got.PrefixIPs != 32 {
+		t.Errorf("PrefixIPs = %v, want %v", got.PrefixIPs, 32)
+	}
+	if got.FreeIPsDiscrepancy != -9 {
+		t.Errorf("FreeIPsDiscrepancy = %v, want %v", got.FreeIPsDiscrepancy, -9)
+	}
+	if sum := got.ReservedIPs + got.InterfaceIPs + got.PrefixIPs + got.ExplicitReservedUnusedIPs; sum != got.AllocatedIPs {
+		t.Errorf("breakdown adds up to %v, want AllocatedIPs %v", sum, got.AllocatedIPs)
+	}
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/aggregate"
+)
+
+// Availability zone imbalance of a VPC or tag group
+type GroupImbalance struct {
+	VPCID            string `json:"vpcId,omitempty"`
+	GroupTag         string `json:"groupTag,omitempty"`
+	GroupValue       string `json:"groupValue,omitempty"`
+	AZs              int    `json:"azs"`
+	FirstToRunOut    string `json:"firstToRunOut"`
+	MinFreeIPs       int    `json:"minFreeIps"`
+	MaxFreeIPs       int    `json:"maxFreeIps"`
+	FreeIPsSkew      int    `json:"freeIpsSkew"`
+	MinFreePrefixes  int    `json:"minFreePrefixes"`
+	MaxFreePrefixes  int    `json:"maxFreePrefixes"`
+	FreePrefixesSkew int    `json:"freePrefixesSkew"`
+}
+
+type imbalanceResponse struct {
+	Updated time.Time        `json:"updated"`
+	VPCs    []GroupImbalance `json:"vpcs"`
+	Groups  []GroupImbalance `json:"groups"`
+}
+
+func newGroupImbalance(i aggregate.Imbalance) GroupImbalance {
+	return GroupImbalance{
+		VPCID:            i.VPCID,
+		GroupTag:         i.GroupTag,
+		GroupValue:       i.GroupValue,
+		AZs:              i.AZs,
+		FirstToRunOut:    i.FirstToRunOut,
+		MinFreeIPs:       i.MinFreeIPs,
+		MaxFreeIPs:       i.MaxFreeIPs,
+		FreeIPsSkew:      i.FreeIPsSkew(),
+		MinFreePrefixes:  i.MinFreePrefixes,
+		MaxFreePrefixes:  i.MaxFreePrefixes,
+		FreePrefixesSkew: i.FreePrefixesSkew(),
+	}
+}
+
+// Serve the availability zone imbalance of every VPC and tag group, naming the
+// availability zone that will run out of IPs first
+func ImbalanceHandler(store *Store, groupTags []string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		snapshot := store.Snapshot()
+		resp := imbalanceResponse{Updated: snapshot.Updated, VPCs: []GroupImbalance{}, Groups: []GroupImbalance{}}
+		for _, i := range aggregate.VPCImbalances(snapshot.Subnets) {
+			resp.VPCs = append(resp.VPCs, newGroupImbalance(i))
+		}
+		for _, tag := range groupTags {
+			for _, i := range aggregate.TagImbalances(snapshot.Subnets, tag) {
+				resp.Groups = append(resp.Groups, newGroupImbalance(i))
+			}
+		}
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/aws"
+	log "github.com/sirupsen/logrus"
+)
+
+// Path of the IP lookup API, the address follows after a slash
+const IPPath = "/api/v1/ip"
+
+// How an IP is assigned to its network interface
+const (
+	AssignmentPrimary   = "primary"
+	AssignmentSecondary = "secondary"
+	AssignmentPrefix    = "prefix"
+)
+
+// Network interface holding an IP and how the IP is assigned to it. Subnet and Interface
+// point into the snapshot the index was built from, which must not be modified.
+type IPHolder struct {
+	Subnet     *aws.Subnet
+	Interface  *aws.NetworkInterface
+	Assignment string
+	// Delegated prefix containing the IP when it is assigned as part of a prefix
+	Prefix string
+}
+
+// Holders of the IPs and delegated prefixes of a snapshot, built on every update so
+// lookups do not scan every network interface
+type ipIndex struct {
+	ips      map[netip.Addr]IPHolder
+	prefixes map[netip.Prefix]IPHolder
+	// Lengths of the delegated prefixes in the index, /28 for IPv4 prefix delegation
+	prefixBits map[int]bool
+}
+
+func newIPIndex(subnets []aws.Subnet) ipIndex {
+	index := ipIndex{
+		ips:        map[netip.Addr]IPHolder{},
+		prefixes:   map[netip.Prefix]IPHolder{},
+		prefixBits: map[int]bool{},
+	}
+	for i := range subnets {
+		s := &subnets[i]
+		for j := range s.Interfaces {
+			iface := &s.Interfaces[j]
+			for _, ip := range iface.PrivateIPs {
+				addr, err := netip.ParseAddr(ip.Address)
+				if err != nil {
+					log.WithField("interface", iface.InterfaceID).Warnf("Ignoring invalid private IP %q", ip.Address)
+					continue
+				}
+				assignment := AssignmentSecondary
+				if ip.Primary {
+					assignment = AssignmentPrimary
+				}
+				index.ips[addr] = IPHolder{Subnet: s, Interface: iface, Assignment: assignment}
+			}
+			for _, p := range iface.Prefixes {
+				prefix, err := netip.ParsePrefix(p)
+				if err != nil {
+					log.WithField("interface", iface.InterfaceID).Warnf("Ignoring invalid delegated prefix %q", p)
+					continue
+				}
+				index.prefixes[prefix.Masked()] = IPHolder{Subnet: s, Interface: iface, Assignment: AssignmentPrefix, Prefix: p}
+				index.prefixBits[prefix.Bits()] = true
+			}
+		}
+	}
+	return index
+}
+
+func (i ipIndex) lookup(addr netip.Addr) (IPHolder, bool) {
+	if holder, ok := i.ips[addr]; ok {
+		return holder, true
+	}
+	for bits := range i.prefixBits {
+		prefix, err := addr.Prefix(bits)
+		if err != nil {
+			continue
+		}
+		if holder, ok := i.prefixes[prefix]; ok {
+			return holder, true
+		}
+	}
+	return IPHolder{}, false
+}
+
+type ipResponse struct {
+	Updated    time.Time `json:"updated"`
+	Address    string    `json:"address"`
+	SubnetID   string    `json:"subnetId"`
+	SubnetName string    `json:"subnetName"`
+	VPCID      string    `json:"vpcId"`
+	AZ         string    `json:"az"`
+	// primary, secondary or prefix
+	Assignment    string `json:"assignment"`
+	Prefix        string `json:"prefix,omitempty"`
+	InterfaceID   string `json:"interfaceId"`
+	InterfaceType string `json:"interfaceType"`
+	// Instance the interface is attached to, or the service managing it
+	Attachment  string            `json:"attachment"`
+	InstanceID  string            `json:"instanceId,omitempty"`
+	Description string            `json:"description"`
+	Tags        map[string]string `json:"tags"`
+}
+
+// Instance the interface is attached to, or else the service that manages it as told
+// by its type or description, e.g. nat_gateway or "ELB app/my-alb/50dc6c495c0c9188"
+func attachment(iface aws.NetworkInterface) string {
+	switch {
+	case iface.InstanceID != "":
+		return iface.InstanceID
+	case iface.InterfaceType != "" && iface.InterfaceType != "interface":
+		return iface.InterfaceType
+	default:
+		return iface.Description
+	}
+}
+
+// Serve the network interface holding an IP on /api/v1/ip/{address} from the latest snapshot
+func IPHandler(store *Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		address := strings.Trim(strings.TrimPrefix(r.URL.Path, IPPath), "/")
+		addr, err := netip.ParseAddr(address)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid IP address: "+address)
+			return
+		}
+		holder, updated, ok := store.LookupIP(addr)
+		if !ok {
+			writeError(w, http.StatusNotFound, "IP not in use by any network interface: "+address)
+			return
+		}
+		writeJSON(w, http.StatusOK, ipResponse{
+			Updated:       updated,
+			Address:       addr.String(),
+			SubnetID:      holder.Subnet.SubnetID,
+			SubnetName:    holder.Subnet.Name,
+			VPCID:         holder.Subnet.VPCID,
+			AZ:            holder.Subnet.AZ,
+			Assignment:    holder.Assignment,
+			Prefix:        holder.Prefix,
+			InterfaceID:   holder.Interface.InterfaceID,
+			InterfaceType: holder.Interface.InterfaceType,
+			Attachment:    attachment(*holder.Interface),
+			InstanceID:    holder.Interface.InstanceID,
+			Description:   holder.Interface.Description,
+			Tags:          holder.Interface.Tags,
+		})
+	}
+}
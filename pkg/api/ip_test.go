@@ -0,0 +1,70 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/aws"
+)
+
+func TestIPHandler(t *testing.T) {
+	updated := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := NewStore()
+	store.Update(Snapshot{Updated: updated, Subnets: []aws.Subnet{{
+		SubnetID: "subnet-1",
+		VPCID:    "vpc-1",
+		Interfaces: []aws.NetworkInterface{
+			{
+				InterfaceID:   "eni-1",
+				InterfaceType: "interface",
+				InstanceID:    "i-1",
+				PrivateIPs:    []aws.PrivateIP{{Address: "10.0.1.10", Primary: true}, {Address: "10.0.1.11"}},
+				Prefixes:      []string{"10.0.1.32/28"},
+				Tags:          map[string]string{"cluster.k8s.amazonaws.com/name": "prod"},
+			},
+			{
+				InterfaceID:   "eni-2",
+				InterfaceType: "nat_gateway",
+				Description:   "Interface for NAT Gateway nat-1",
+				PrivateIPs:    []aws.PrivateIP{{Address: "10.0.1.20", Primary: true}},
+			},
+		},
+	}}})
+
+	tests := []struct {
+		address        string
+		wantStatus     int
+		wantInterface  string
+		wantAssignment string
+		wantAttachment string
+	}{
+		{"10.0.1.10", http.StatusOK, "eni-1", AssignmentPrimary, "i-1"},
+		{"10.0.1.11", http.StatusOK, "eni-1", AssignmentSecondary, "i-1"},
+		{"10.0.1.47", http.StatusOK, "eni-1", AssignmentPrefix, "i-1"},
+		{"10.0.1.20", http.StatusOK, "eni-2", AssignmentPrimary, "nat_gateway"},
+		{"10.0.1.48", http.StatusNotFound, "", "", ""},
+		{"10.0.1", http.StatusBadRequest, "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			IPHandler(store)(rec, httptest.NewRequest(http.MethodGet, "/api/v1/ip/"+tt.address, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("IPHandler() status = %v, want %v", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var resp ipResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("IPHandler() returned invalid JSON: %v", err)
+			}
+			if resp.SubnetID != "subnet-1" || resp.InterfaceID != tt.wantInterface || resp.Assignment != tt.wantAssignment || resp.Attachment != tt.wantAttachment || !resp.Updated.Equal(updated) {
+				t.Errorf("IPHandler() = %+v", resp)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/aws"
+)
+
+// Data gathered from AWS in one refresh
+type Snapshot struct {
+	Subnets []aws.Subnet
+	VPCs    []aws.VPC
+	Updated time.Time
+}
+
+// Store holds the latest snapshot fetched from AWS so HTTP handlers never have
+// to call AWS themselves
+type Store struct {
+	mu       sync.RWMutex
+	snapshot Snapshot
+	ips      ipIndex
+}
+
+func NewStore() *Store {
+	return &Store{}
+}
+
+// Replace the snapshot with data from the latest refresh
+func (s *Store) Update(snapshot Snapshot) {
+	if snapshot.Updated.IsZero() {
+		snapshot.Updated = time.Now()
+	}
+	ips := newIPIndex(snapshot.Subnets)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshot = snapshot
+	s.ips = ips
+}
+
+// Latest snapshot, callers must not modify the returned slices
+func (s *Store) Snapshot() Snapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.snapshot
+}
+
+// Network interface holding the IP in the latest snapshot and when that snapshot was taken
+func (s *Store) LookupIP(addr netip.Addr) (IPHolder, time.Time, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	holder, ok := s.ips.lookup(addr)
+	return holder, s.snapshot.Updated, ok
+}
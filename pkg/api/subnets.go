@@ -0,0 +1,134 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/aws"
+)
+
+// Path of the subnets API, a subnet ID may follow after a slash
+const SubnetsPath = "/api/v1/subnets"
+
+const defaultFreeIPs = 5
+
+type subnetsResponse struct {
+	Updated time.Time    `json:"updated"`
+	Subnets []aws.Subnet `json:"subnets"`
+}
+
+type subnetResponse struct {
+	Updated time.Time  `json:"updated"`
+	Subnet  aws.Subnet `json:"subnet"`
+}
+
+type freeIPsResponse struct {
+	Updated   time.Time `json:"updated"`
+	SubnetID  string    `json:"subnetId"`
+	CIDRBlock string    `json:"cidrBlock"`
+	FreeIPs   []string  `json:"freeIps"`
+}
+
+// Criteria a subnet has to match to be listed, empty fields match every subnet
+type subnetFilter struct {
+	VPCID   string
+	AZ      string
+	Account string
+	// Tag keys mapped to the required value, an empty value only requires the key
+	Tags map[string]string
+}
+
+// Read the filter from the query, e.g. ?vpc=vpc-123&az=eu-west-2a&account=123456789012&tag=Environment=prod&tag=Shared
+func parseSubnetFilter(r *http.Request) subnetFilter {
+	query := r.URL.Query()
+	filter := subnetFilter{
+		VPCID:   query.Get("vpc"),
+		AZ:      query.Get("az"),
+		Account: query.Get("account"),
+		Tags:    map[string]string{},
+	}
+	for _, tag := range query["tag"] {
+		parts := strings.SplitN(tag, "=", 2)
+		if len(parts) == 2 {
+			filter.Tags[parts[0]] = parts[1]
+		} else {
+			filter.Tags[parts[0]] = ""
+		}
+	}
+	return filter
+}
+
+func (f subnetFilter) matches(s aws.Subnet) bool {
+	if (f.VPCID != "" && s.VPCID != f.VPCID) || (f.AZ != "" && s.AZ != f.AZ) || (f.Account != "" && s.OwnerID != f.Account) {
+		return false
+	}
+	for k, v := range f.Tags {
+		value, ok := s.Tags[k]
+		if !ok || (v != "" && value != v) {
+			return false
+		}
+	}
+	return true
+}
+
+// Serve the subnets of the latest snapshot, all of them filtered by the query on
+// /api/v1/subnets, a single one on /api/v1/subnets/{id} and its first free IPs on
+// /api/v1/subnets/{id}/free-ips?count=5
+func SubnetsHandler(store *Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		snapshot := store.Snapshot()
+		id := strings.Trim(strings.TrimPrefix(r.URL.Path, SubnetsPath), "/")
+		if id == "" {
+			filter := parseSubnetFilter(r)
+			resp := subnetsResponse{Updated: snapshot.Updated, Subnets: []aws.Subnet{}}
+			for _, s := range snapshot.Subnets {
+				if filter.matches(s) {
+					resp.Subnets = append(resp.Subnets, s)
+				}
+			}
+			writeJSON(w, http.StatusOK, resp)
+			return
+		}
+
+		id, resource, _ := strings.Cut(id, "/")
+		if resource != "" && resource != "free-ips" {
+			writeError(w, http.StatusNotFound, "not found: "+r.URL.Path)
+			return
+		}
+		subnet, ok := findSubnet(snapshot.Subnets, id)
+		if !ok {
+			writeError(w, http.StatusNotFound, "subnet not found: "+id)
+			return
+		}
+		if resource == "" {
+			writeJSON(w, http.StatusOK, subnetResponse{Updated: snapshot.Updated, Subnet: subnet})
+			return
+		}
+
+		count := defaultFreeIPs
+		if r.URL.Query().Get("count") != "" {
+			var err error
+			if count, err = strconv.Atoi(r.URL.Query().Get("count")); err != nil {
+				writeError(w, http.StatusBadRequest, "count must be a number")
+				return
+			}
+		}
+		free, err := subnet.FreeAddresses(count)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, freeIPsResponse{Updated: snapshot.Updated, SubnetID: subnet.SubnetID, CIDRBlock: subnet.CIDRBlock, FreeIPs: free})
+	}
+}
+
+func findSubnet(subnets []aws.Subnet, id string) (aws.Subnet, bool) {
+	for _, s := range subnets {
+		if s.SubnetID == id {
+			return s, true
+		}
+	}
+	return aws.Subnet{}, false
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/aws"
+)
+
+func TestSubnetsHandler(t *testing.T) {
+	store := NewStore()
+	store.Update(Snapshot{Subnets: []aws.Subnet{
+		{SubnetID: "subnet-1", VPCID: "vpc-1", AZ: "eu-west-2a", OwnerID: "111111111111", Tags: map[string]string{"Environment": "prod", "Shared": "true"}, AvailablePrefixes: []string{"10.0.1.16/28"}},
+		{SubnetID: "subnet-2", VPCID: "vpc-1", AZ: "eu-west-2b", OwnerID: "111111111111", Tags: map[string]string{"Environment": "dev"}},
+		{SubnetID: "subnet-3", VPCID: "vpc-2", AZ: "eu-west-2a", OwnerID: "222222222222", Tags: map[string]string{"Environment": "prod"}},
+	}})
+
+	tests := []struct {
+		name string
+		url  string
+		want []string
+	}{
+		{"all", "/api/v1/subnets", []string{"subnet-1", "subnet-2", "subnet-3"}},
+		{"vpc", "/api/v1/subnets?vpc=vpc-1", []string{"subnet-1", "subnet-2"}},
+		{"az", "/api/v1/subnets?az=eu-west-2a", []string{"subnet-1", "subnet-3"}},
+		{"account", "/api/v1/subnets?account=222222222222", []string{"subnet-3"}},
+		{"tag value", "/api/v1/subnets?tag=Environment=prod", []string{"subnet-1", "subnet-3"}},
+		{"tag key", "/api/v1/subnets?tag=Shared", []string{"subnet-1"}},
+		{"combined", "/api/v1/subnets?vpc=vpc-1&tag=Environment=prod&tag=Shared=false", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			SubnetsHandler(store)(rec, httptest.NewRequest(http.MethodGet, tt.url, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("SubnetsHandler() status = %v, want %v", rec.Code, http.StatusOK)
+			}
+			var resp subnetsResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("SubnetsHandler() returned invalid JSON: %v", err)
+			}
+			got := []string{}
+			for _, s := range resp.Subnets {
+				got = append(got, s.SubnetID)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("SubnetsHandler() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubnetsHandlerSingle(t *testing.T) {
+	store := NewStore()
+	store.Update(Snapshot{Subnets: []aws.Subnet{
+		{SubnetID: "subnet-1", AvailablePrefixes: []string{"10.0.1.16/28", "10.0.1.32/28"}},
+	}})
+
+	rec := httptest.NewRecorder()
+	SubnetsHandler(store)(rec, httptest.NewRequest(http.MethodGet, "/api/v1/subnets/subnet-1", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("SubnetsHandler() status = %v, want %v", rec.Code, http.StatusOK)
+	}
+	var resp subnetResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("SubnetsHandler() returned invalid JSON: %v", err)
+	}
+	if resp.Subnet.SubnetID != "subnet-1" || len(resp.Subnet.AvailablePrefixes) != 2 {
+		t.Errorf("SubnetsHandler() = %+v", resp.Subnet)
+	}
+
+	rec = httptest.NewRecorder()
+	SubnetsHandler(store)(rec, httptest.NewRequest(http.MethodGet, "/api/v1/subnets/subnet-404", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("SubnetsHandler() status = %v, want %v", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestSubnetsHandlerFreeIPs(t *testing.T) {
+	store := NewStore()
+	store.Update(Snapshot{Subnets: []aws.Subnet{{
+		SubnetID:      "subnet-1",
+		CIDRBlock:     "10.0.1.0/24",
+		IPsInUse:      map[string]bool{"10.0.1.4": true},
+		PrefixesInUse: map[string]bool{"10.0.1.0/28": true},
+	}}})
+
+	tests := []struct {
+		url        string
+		wantStatus int
+		want       []string
+	}{
+		{"/api/v1/subnets/subnet-1/free-ips?count=2", http.StatusOK, []string{"10.0.1.16", "10.0.1.17"}},
+		{"/api/v1/subnets/subnet-1/free-ips", http.StatusOK, []string{"10.0.1.16", "10.0.1.17", "10.0.1.18", "10.0.1.19", "10.0.1.20"}},
+		{"/api/v1/subnets/subnet-1/free-ips?count=0", http.StatusBadRequest, nil},
+		{"/api/v1/subnets/subnet-1/free-ips?count=257", http.StatusBadRequest, nil},
+		{"/api/v1/subnets/subnet-1/other", http.StatusNotFound, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			SubnetsHandler(store)(rec, httptest.NewRequest(http.MethodGet, tt.url, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("SubnetsHandler() status = %v, want %v", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var resp freeIPsResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("SubnetsHandler() returned invalid JSON: %v", err)
+			}
+			if strings.Join(resp.FreeIPs, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("SubnetsHandler() = %v, want %v", resp.FreeIPs, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package aws
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+)
+
+const (
+	// Tags the VPC CNI puts on the network interfaces it creates
+	cniClusterNameTag    = "cluster.k8s.amazonaws.com/name"
+	cniNodeInstanceIDTag = "node.k8s.amazonaws.com/instance_id"
+
+	// Tags on the instances of EKS managed node groups and Karpenter node pools
+	eksClusterNameTag    = "eks:cluster-name"
+	eksNodeGroupTag      = "eks:nodegroup-name"
+	karpenterNodePoolTag = "karpenter.sh/nodepool"
+	kubernetesClusterTag = "kubernetes.io/cluster/"
+)
+
+// Usage of a subnet by one EKS cluster and node group. Both are empty for network
+// interfaces that can not be tied to a cluster, e.g. load balancers.
+type Attribution struct {
+	Cluster    string `json:"cluster"`
+	NodeGroup  string `json:"nodeGroup"`
+	Interfaces int    `json:"interfaces"`
+	IPs        int    `json:"ips"`
+	Prefixes   int    `json:"prefixes"`
+}
+
+// Break down the IP and prefix usage of every subnet by EKS cluster and node group,
+// describing the instances the network interfaces belong to in batches
+func AttributeUsage(client *ec2.Client, subnets []Subnet) error {
+	instances, err := GetInstances(client, InstanceIDs(subnets))
+	if err != nil {
+		return err
+	}
+	for i := range subnets {
+		subnets[i].Usage = attributeUsage(subnets[i].Interfaces, instances)
+	}
+	return nil
+}
+
+// IDs of the instances the network interfaces in the subnets belong to
+func InstanceIDs(subnets []Subnet) []string {
+	seen := map[string]bool{}
+	var ids []string
+	for _, s := range subnets {
+		for _, iface := range s.Interfaces {
+			id := interfaceInstanceID(iface)
+			if id != "" && !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+func interfaceInstanceID(iface NetworkInterface) string {
+	if id := iface.Tags[cniNodeInstanceIDTag]; id != "" {
+		return id
+	}
+	return iface.InstanceID
+}
+
+func attributeUsage(interfaces []NetworkInterface, instances map[string]Instance) []Attribution {
+	usage := map[[2]string]*Attribution{}
+	for _, iface := range interfaces {
+		instance := instances[interfaceInstanceID(iface)]
+		cluster := iface.Tags[cniClusterNameTag]
+		if cluster == "" {
+			cluster = instanceCluster(instance)
+		}
+		nodeGroup := instance.Tags[eksNodeGroupTag]
+		if nodeGroup == "" {
+			nodeGroup = instance.Tags[karpenterNodePoolTag]
+		}
+
+		key := [2]string{cluster, nodeGroup}
+		if _, ok := usage[key]; !ok {
+			usage[key] = &Attribution{Cluster: cluster, NodeGroup: nodeGroup}
+		}
+		usage[key].Interfaces++
+		usage[key].IPs += len(iface.PrivateIPs)
+		usage[key].Prefixes += len(iface.Prefixes)
+	}
+
+	attributions := make([]Attribution, 0, len(usage))
+	for _, a := range usage {
+		attributions = append(attributions, *a)
+	}
+	sort.Slice(attributions, func(i, j int) bool {
+		if attributions[i].Cluster != attributions[j].Cluster {
+			return attributions[i].Cluster < attributions[j].Cluster
+		}
+		return attributions[i].NodeGroup < attributions[j].NodeGroup
+	})
+	return attributions
+}
+
+// Cluster an instance belongs to, from the EKS tag or the kubernetes.io/cluster/<name> tag
+func instanceCluster(instance Instance) string {
+	if cluster := instance.Tags[eksClusterNameTag]; cluster != "" {
+		return cluster
+	}
+	for k := range instance.Tags {
+		if strings.HasPrefix(k, kubernetesClusterTag) {
+			return strings.TrimPrefix(k, kubernetesClusterTag)
+		}
+	}
+	return ""
+}
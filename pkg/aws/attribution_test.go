@@ -0,0 +1,53 @@
+package aws
+
+import (
+	"testing"
+)
+
+func TestAttributeUsage(t *testing.T) {
+	interfaces := []NetworkInterface{
+		{
+			// primary interface of a managed node group node, only tied to the instance by its attachment
+			InterfaceID: "eni-1",
+			InstanceID:  "i-1",
+			PrivateIPs:  []PrivateIP{{Address: "10.0.0.10", Primary: true}},
+			Prefixes:    []string{"10.0.0.16/28"},
+		},
+		{
+			InterfaceID: "eni-2",
+			Tags:        map[string]string{cniClusterNameTag: "live", cniNodeInstanceIDTag: "i-1"},
+			PrivateIPs:  []PrivateIP{{Address: "10.0.0.11", Primary: true}},
+			Prefixes:    []string{"10.0.0.32/28", "10.0.0.48/28"},
+		},
+		{
+			InterfaceID: "eni-3",
+			InstanceID:  "i-2",
+			PrivateIPs:  []PrivateIP{{Address: "10.0.0.12", Primary: true}, {Address: "10.0.0.13"}},
+		},
+		{
+			InterfaceID:   "eni-4",
+			InterfaceType: "network_load_balancer",
+			PrivateIPs:    []PrivateIP{{Address: "10.0.0.14", Primary: true}},
+		},
+	}
+	instances := map[string]Instance{
+		"i-1": {InstanceID: "i-1", Tags: map[string]string{eksClusterNameTag: "live", eksNodeGroupTag: "default-ng"}},
+		"i-2": {InstanceID: "i-2", Tags: map[string]string{kubernetesClusterTag + "manager": "owned", karpenterNodePoolTag: "spot"}},
+	}
+
+	want := []Attribution{
+		{Cluster: "", NodeGroup: "", Interfaces: 1, IPs: 1},
+		{Cluster: "live", NodeGroup: "default-ng", Interfaces: 2, IPs: 2, Prefixes: 3},
+		{Cluster: "manager", NodeGroup: "spot", Interfaces: 1, IPs: 2},
+	}
+
+	got := attributeUsage(interfaces, instances)
+	if len(got) != len(want) {
+		t.Fatalf("attributeUsage() = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("attributeUsage()[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
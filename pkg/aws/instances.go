@@ -0,0 +1,59 @@
+package aws
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Instance IDs passed to a single DescribeInstances call, at most the values a filter takes
+const describeInstancesBatchSize = 200
+
+type Instance struct {
+	InstanceID   string
+	InstanceType string
+	Tags         map[string]string
+}
+
+// Describe the instances with the given IDs in batches, keyed by instance ID. The IDs
+// are passed as a filter rather than as InstanceIds, so IDs of terminated instances left
+// behind in network interface tags are skipped instead of failing the whole batch.
+func GetInstances(client *ec2.Client, instanceIDs []string) (map[string]Instance, error) {
+	instances := map[string]Instance{}
+	for start := 0; start < len(instanceIDs); start += describeInstancesBatchSize {
+		end := start + describeInstancesBatchSize
+		if end > len(instanceIDs) {
+			end = len(instanceIDs)
+		}
+		log.Debugf("Describing %d instances", end-start)
+		paginator := ec2.NewDescribeInstancesPaginator(client, &ec2.DescribeInstancesInput{
+			Filters: []types.Filter{{
+				Name:   aws.String("instance-id"),
+				Values: instanceIDs[start:end],
+			}},
+		})
+		for paginator.HasMorePages() {
+			resp, err := paginator.NextPage(context.TODO())
+			if err != nil {
+				log.Debug("Failed to describe instances")
+				return nil, errors.Wrap(err, "cannot describe instances")
+			}
+			for _, r := range resp.Reservations {
+				for _, v := range r.Instances {
+					instance := Instance{
+						InstanceID:   aws.ToString(v.InstanceId),
+						InstanceType: string(v.InstanceType),
+						Tags:         utils.GetTagsMap(v.Tags),
+					}
+					instances[instance.InstanceID] = instance
+				}
+			}
+		}
+	}
+	return instances, nil
+}
@@ -0,0 +1,64 @@
+package aws
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/utils"
+)
+
+// Network interface in a subnet and the addresses it holds
+type NetworkInterface struct {
+	InterfaceID   string `json:"interfaceId"`
+	InterfaceType string `json:"interfaceType"`
+	Description   string `json:"description"`
+	// Instance the interface is attached to, empty for interfaces managed by other services
+	InstanceID string            `json:"instanceId"`
+	PrivateIPs []PrivateIP       `json:"privateIps"`
+	Prefixes   []string          `json:"prefixes"`
+	Tags       map[string]string `json:"tags"`
+}
+
+type PrivateIP struct {
+	Address string `json:"address"`
+	Primary bool   `json:"primary"`
+}
+
+func newNetworkInterfaces(output *ec2.DescribeNetworkInterfacesOutput) []NetworkInterface {
+	interfaces := make([]NetworkInterface, 0, len(output.NetworkInterfaces))
+	for _, v := range output.NetworkInterfaces {
+		iface := NetworkInterface{
+			InterfaceID:   aws.ToString(v.NetworkInterfaceId),
+			InterfaceType: string(v.InterfaceType),
+			Description:   aws.ToString(v.Description),
+			Tags:          utils.GetTagsMap(v.TagSet),
+		}
+		if v.Attachment != nil {
+			iface.InstanceID = aws.ToString(v.Attachment.InstanceId)
+		}
+		for _, ip := range v.PrivateIpAddresses {
+			iface.PrivateIPs = append(iface.PrivateIPs, PrivateIP{
+				Address: aws.ToString(ip.PrivateIpAddress),
+				Primary: aws.ToBool(ip.Primary),
+			})
+		}
+		for _, prefix := range v.Ipv4Prefixes {
+			iface.Prefixes = append(iface.Prefixes, aws.ToString(prefix.Ipv4Prefix))
+		}
+		interfaces = append(interfaces, iface)
+	}
+	return interfaces
+}
+
+// IPs the VPC CNI assigned to the network interfaces of a node in one subnet, as
+// secondary IPs or delegated prefixes, and how many of them pods use
+type NodeIPUsage struct {
+	Node        string `json:"node"`
+	InstanceID  string `json:"instanceId"`
+	AssignedIPs int    `json:"assignedIps"`
+	PodIPs      int    `json:"podIps"`
+}
+
+// Assigned IPs no pod uses
+func (n NodeIPUsage) IdleIPs() int {
+	return n.AssignedIPs - n.PodIPs
+}
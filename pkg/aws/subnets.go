@@ -3,6 +3,7 @@ package aws
 import (
 	"context"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"github.com/ministryofjustice/aws-subnet-exporter/pkg/utils"
@@ -11,15 +12,56 @@ import (
 )
 
 type Subnet struct {
-	Name              string
-	SubnetID          string
-	VPCID             string
-	CIDRBlock         string
-	AZ                string
-	AvailableIPs      float64
-	MaxIPs            float64
-	UsedPrefixes      int
-	AvailablePrefixes []string
+	Name     string `json:"name"`
+	SubnetID string `json:"subnetId"`
+	VPCID    string `json:"vpcId"`
+	// AWS account that owns the subnet
+	OwnerID   string `json:"ownerId"`
+	CIDRBlock string `json:"cidrBlock"`
+	// IPv6 CIDR blocks associated with the subnet
+	IPv6CIDRBlocks    []string          `json:"ipv6CidrBlocks"`
+	AZ                string            `json:"az"`
+	Tags              map[string]string `json:"tags"`
+	AvailableIPs      float64           `json:"availableIps"`
+	MaxIPs            float64           `json:"maxIps"`
+	UsedPrefixes      int               `json:"usedPrefixes"`
+	AvailablePrefixes []string          `json:"availablePrefixes"`
+	MaxPrefixes       int               `json:"maxPrefixes"`
+	TotalIPs          int               `json:"totalIps"`
+	InterfaceIPs      int               `json:"interfaceIps"`
+	AllocatedIPs      int               `json:"allocatedIps"`
+	FreeIPs           int               `json:"freeIps"`
+	InterfacesInUse   int               `json:"interfacesInUse"`
+	// Trunk and branch network interfaces of security groups for pods
+	TrunkInterfaces  int                     `json:"trunkInterfaces"`
+	BranchInterfaces int                     `json:"branchInterfaces"`
+	BranchIPs        int                     `json:"branchIps"`
+	Reservations     []utils.CIDRReservation `json:"reservations"`
+	// IPs held by explicit CIDR reservations
+	ExplicitReservedIPs int `json:"explicitReservedIps"`
+	// IPs of explicit CIDR reservations that no network interface uses
+	ExplicitReservedUnusedIPs int `json:"explicitReservedUnusedIps"`
+	// Available prefixes inside prefix CIDR reservations and outside any reservation
+	ReservedAvailablePrefixes   int `json:"reservedAvailablePrefixes"`
+	UnreservedAvailablePrefixes int `json:"unreservedAvailablePrefixes"`
+	// Estimated additional pods the subnet can hold, filled in by the capacity package
+	PodCapacity int `json:"podCapacity"`
+	// Estimated additional nodes per instance type, filled in by the capacity package
+	NodeHeadroom map[string]int `json:"nodeHeadroom"`
+	// Network interfaces in the subnet
+	Interfaces []NetworkInterface `json:"interfaces"`
+	// IP and prefix usage per EKS cluster and node group, filled in by AttributeUsage
+	Usage []Attribution `json:"usage"`
+	// Alert thresholds read from the subnet tags
+	Thresholds Thresholds `json:"thresholds"`
+	// Names of the ENIConfigs placing pods in the subnet with EKS custom networking
+	ENIConfigs []string `json:"eniConfigs"`
+	// IPs the VPC CNI assigned to nodes in the subnet and how many of them pods use,
+	// filled in from Kubernetes
+	NodeIPs []NodeIPUsage `json:"nodeIps"`
+	// IPs and delegated prefixes in use as found by utils.EnrichIPsAndPrefixes
+	IPsInUse      map[string]bool `json:"-"`
+	PrefixesInUse map[string]bool `json:"-"`
 }
 
 func GetSubnets(client *ec2.Client, filter string) ([]Subnet, error) {
@@ -47,16 +89,37 @@ func GetSubnets(client *ec2.Client, filter string) ([]Subnet, error) {
 	return subnets, nil
 }
 
+func GetSubnetByID(client *ec2.Client, subnetID string) (Subnet, error) {
+	log.Debugf("Describing subnet %s", subnetID)
+	resp, err := utils.DescribeSubnetByID(context.TODO(), client, subnetID)
+	if err != nil {
+		return Subnet{}, errors.Wrap(err, "cannot describe subnet")
+	}
+	if len(resp.Subnets) == 0 {
+		return Subnet{}, errors.Errorf("subnet not found: %s", subnetID)
+	}
+	return processSubnet(client, resp.Subnets[0])
+}
+
 func processSubnet(ec2Client *ec2.Client, v types.Subnet) (Subnet, error) {
 	log.Debugf("Processing subnet: %s", *v.SubnetId)
 	subnet := Subnet{
 		Name:         utils.GetNameFromTags(v.Tags),
+		Tags:         utils.GetTagsMap(v.Tags),
 		SubnetID:     *v.SubnetId,
 		VPCID:        *v.VpcId,
+		OwnerID:      aws.ToString(v.OwnerId),
 		CIDRBlock:    *v.CidrBlock,
 		AZ:           *v.AvailabilityZone,
 		AvailableIPs: float64(*v.AvailableIpAddressCount),
 	}
+	subnet.Thresholds = thresholdsFromTags(subnet.SubnetID, subnet.Tags)
+	for _, association := range v.Ipv6CidrBlockAssociationSet {
+		if association.Ipv6CidrBlockState != nil && association.Ipv6CidrBlockState.State != types.SubnetCidrBlockStateCodeAssociated {
+			continue
+		}
+		subnet.IPv6CIDRBlocks = append(subnet.IPv6CIDRBlocks, aws.ToString(association.Ipv6CidrBlock))
+	}
 
 	describeSubnetsOutput := &ec2.DescribeSubnetsOutput{
 		Subnets: []types.Subnet{v},
@@ -73,16 +136,84 @@ func processSubnet(ec2Client *ec2.Client, v types.Subnet) (Subnet, error) {
 	if err != nil {
 		return Subnet{}, errors.Wrap(err, "unable to describe network interfaces")
 	}
-	
+
+	subnet.Interfaces = newNetworkInterfaces(networkInterfacesOutput)
+
 	prefixesInUse, ipsInUse, err := utils.EnrichIPsAndPrefixes(networkInterfacesOutput, details)
 	if err != nil {
 		return Subnet{}, errors.Wrap(err, "unable to get IPs and prefixes")
 	}
 
+	reservationsOutput, err := utils.DescribeCidrReservationsBySubnetID(context.TODO(), ec2Client, *v.SubnetId)
+	if err != nil {
+		// reservations only refine the prefix metrics, without them the subnet is treated as unreserved
+		log.WithError(err).WithField("subnetid", *v.SubnetId).Error("Failed to get subnet CIDR reservations")
+		reservationsOutput = &ec2.GetSubnetCidrReservationsOutput{}
+	}
+
+	if err := utils.EnrichReservations(reservationsOutput, details); err != nil {
+		return Subnet{}, errors.Wrap(err, "unable to get subnet CIDR reservations")
+	}
+
 	utils.CalculatePrefixes(details, prefixesInUse, ipsInUse)
 
 	subnet.UsedPrefixes = details.PrefixesInUse
 	subnet.AvailablePrefixes = details.AvailablePrefixes
+	subnet.MaxPrefixes = details.MaxPrefixes
+	subnet.TotalIPs = details.TotalIPs
+	subnet.InterfaceIPs = details.InterfaceIPs
+	subnet.AllocatedIPs = details.AllocatedIPs
+	subnet.FreeIPs = details.FreeIPs
+	subnet.InterfacesInUse = details.InterfacesInUse
+	subnet.TrunkInterfaces = details.TrunkInterfaces
+	subnet.BranchInterfaces = details.BranchInterfaces
+	subnet.BranchIPs = details.BranchIPs
+	subnet.Reservations = details.Reservations
+	subnet.ExplicitReservedIPs = details.ExplicitReservedIPs
+	subnet.ExplicitReservedUnusedIPs = details.ExplicitReservedUnusedIPs
+	subnet.ReservedAvailablePrefixes = details.ReservedAvailablePrefixes
+	subnet.UnreservedAvailablePrefixes = details.UnreservedAvailablePrefixes
+	subnet.IPsInUse = ipsInUse
+	subnet.PrefixesInUse = prefixesInUse
 
 	return subnet, nil
-}
\ No newline at end of file
+}
+
+// Ratio of allocated IPs to the size of the subnet, between 0 and 1
+func (s Subnet) UtilizationRatio() float64 {
+	if s.TotalIPs <= 0 {
+		return 0
+	}
+	return float64(s.AllocatedIPs) / float64(s.TotalIPs)
+}
+
+// First free IPs of the subnet that can be assigned as static private IPs
+func (s Subnet) FreeAddresses(count int) ([]string, error) {
+	return utils.FreeIPs(s.CIDRBlock, s.Reservations, s.PrefixesInUse, s.IPsInUse, count)
+}
+
+// IPs assigned to nodes in the subnet that are used by pods
+func (s Subnet) PodIPs() int {
+	total := 0
+	for _, n := range s.NodeIPs {
+		total += n.PodIPs
+	}
+	return total
+}
+
+// IPs assigned to nodes in the subnet that no pod uses, the warm pool of the VPC CNI
+func (s Subnet) IdleIPs() int {
+	total := 0
+	for _, n := range s.NodeIPs {
+		total += n.IdleIPs()
+	}
+	return total
+}
+
+// Difference between the free IPs reported by AWS and the free IPs computed from
+// network interfaces. Negative values mean AWS sees IPs held by resources that are
+// not visible as network interfaces, positive values point at overcounting in the
+// computed numbers.
+func (s Subnet) AvailableIPsDiscrepancy() int {
+	return int(s.AvailableIPs) - s.FreeIPs
+}
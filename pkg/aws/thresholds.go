@@ -0,0 +1,40 @@
+package aws
+
+import (
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// Subnet tags holding alert thresholds for the subnet
+	minFreeIPsTag      = "aws-subnet-exporter/min-free-ips"
+	minFreePrefixesTag = "aws-subnet-exporter/min-free-prefixes"
+)
+
+// Alert thresholds of a subnet, nil when the subnet has no valid threshold tag
+type Thresholds struct {
+	MinFreeIPs      *int `json:"minFreeIps,omitempty"`
+	MinFreePrefixes *int `json:"minFreePrefixes,omitempty"`
+}
+
+func thresholdsFromTags(subnetID string, tags map[string]string) Thresholds {
+	return Thresholds{
+		MinFreeIPs:      thresholdFromTag(subnetID, tags, minFreeIPsTag),
+		MinFreePrefixes: thresholdFromTag(subnetID, tags, minFreePrefixesTag),
+	}
+}
+
+// Threshold in the tag, invalid values are logged and ignored rather than failing the subnet
+func thresholdFromTag(subnetID string, tags map[string]string, key string) *int {
+	value, ok := tags[key]
+	if !ok {
+		return nil
+	}
+	threshold, err := strconv.Atoi(value)
+	if err != nil || threshold < 0 {
+		log.WithFields(log.Fields{"subnet": subnetID, "tag": key, "value": value}).Warn("Ignoring invalid threshold tag")
+		return nil
+	}
+	return &threshold
+}
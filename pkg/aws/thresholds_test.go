@@ -0,0 +1,46 @@
+package aws
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestThresholdsFromTags(t *testing.T) {
+	tests := []struct {
+		name string
+		tags map[string]string
+		want Thresholds
+	}{
+		{
+			name: "no tags",
+			want: Thresholds{},
+		},
+		{
+			name: "both thresholds",
+			tags: map[string]string{minFreeIPsTag: "100", minFreePrefixesTag: "8"},
+			want: Thresholds{MinFreeIPs: intPtr(100), MinFreePrefixes: intPtr(8)},
+		},
+		{
+			name: "zero is kept apart from a missing tag",
+			tags: map[string]string{minFreeIPsTag: "0"},
+			want: Thresholds{MinFreeIPs: intPtr(0)},
+		},
+		{
+			name: "invalid values are ignored",
+			tags: map[string]string{minFreeIPsTag: "lots", minFreePrefixesTag: "-1"},
+			want: Thresholds{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := thresholdsFromTags("subnet-1", tt.tags); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("thresholdsFromTags() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func intPtr(v int) *int {
+	return &v
+}
@@ -0,0 +1,124 @@
+package aws
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+type VPC struct {
+	Name  string
+	VPCID string
+	Tags  map[string]string
+	// Primary and secondary IPv4 CIDR blocks associated with the VPC
+	CIDRBlocks []string
+	// Every subnet in the VPC, including subnets left out by the subnet filter
+	Subnets []SubnetCIDR
+}
+
+// Address range of a subnet, without any of the usage data gathered for Subnet
+type SubnetCIDR struct {
+	SubnetID  string
+	AZ        string
+	CIDRBlock string
+}
+
+// CIDR blocks of every subnet in the VPC
+func (v VPC) SubnetCIDRBlocks() []string {
+	cidrs := make([]string, 0, len(v.Subnets))
+	for _, s := range v.Subnets {
+		cidrs = append(cidrs, s.CIDRBlock)
+	}
+	return cidrs
+}
+
+// Describe the VPCs with the given IDs along with the address ranges of all their subnets
+func GetVPCs(client *ec2.Client, vpcIDs []string) ([]VPC, error) {
+	if len(vpcIDs) == 0 {
+		return nil, nil
+	}
+	subnets, err := getVPCSubnets(client, vpcIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debug("Describing VPCs")
+	var vpcs []VPC
+	paginator := ec2.NewDescribeVpcsPaginator(client, &ec2.DescribeVpcsInput{
+		VpcIds: vpcIDs,
+	})
+	for paginator.HasMorePages() {
+		resp, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			log.Debug("Failed to describe VPCs")
+			return nil, errors.Wrap(err, "cannot describe VPCs")
+		}
+		for _, v := range resp.Vpcs {
+			vpc := processVPC(v)
+			vpc.Subnets = subnets[vpc.VPCID]
+			vpcs = append(vpcs, vpc)
+		}
+	}
+	return vpcs, nil
+}
+
+func processVPC(v types.Vpc) VPC {
+	vpc := VPC{
+		Name:  utils.GetNameFromTags(v.Tags),
+		VPCID: aws.ToString(v.VpcId),
+		Tags:  utils.GetTagsMap(v.Tags),
+	}
+	for _, association := range v.CidrBlockAssociationSet {
+		if association.CidrBlockState != nil && association.CidrBlockState.State != types.VpcCidrBlockStateCodeAssociated {
+			continue
+		}
+		vpc.CIDRBlocks = append(vpc.CIDRBlocks, aws.ToString(association.CidrBlock))
+	}
+	return vpc
+}
+
+// Describe every subnet in the VPCs, keyed by VPC ID
+func getVPCSubnets(client *ec2.Client, vpcIDs []string) (map[string][]SubnetCIDR, error) {
+	log.Debug("Describing subnets of VPCs")
+	subnets := map[string][]SubnetCIDR{}
+	paginator := ec2.NewDescribeSubnetsPaginator(client, &ec2.DescribeSubnetsInput{
+		Filters: []types.Filter{{
+			Name:   aws.String("vpc-id"),
+			Values: vpcIDs,
+		}},
+	})
+	for paginator.HasMorePages() {
+		resp, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			log.Debug("Failed to describe subnets of VPCs")
+			return nil, errors.Wrap(err, "cannot describe subnets of VPCs")
+		}
+		for _, v := range resp.Subnets {
+			vpcID := aws.ToString(v.VpcId)
+			subnets[vpcID] = append(subnets[vpcID], SubnetCIDR{
+				SubnetID:  aws.ToString(v.SubnetId),
+				AZ:        aws.ToString(v.AvailabilityZone),
+				CIDRBlock: aws.ToString(v.CidrBlock),
+			})
+		}
+	}
+	return subnets, nil
+}
+
+// IDs of the VPCs the subnets belong to
+func VPCIDs(subnets []Subnet) []string {
+	seen := map[string]bool{}
+	var ids []string
+	for _, s := range subnets {
+		if !seen[s.VPCID] {
+			seen[s.VPCID] = true
+			ids = append(ids, s.VPCID)
+		}
+	}
+	return ids
+}
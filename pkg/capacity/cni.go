@@ -0,0 +1,90 @@
+package capacity
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/utils"
+)
+
+// How the VPC CNI hands out addresses to pods
+type Mode string
+
+const (
+	// Every pod gets a secondary IP of a network interface
+	ModeSecondaryIP Mode = "secondary-ip"
+	// Pods get IPs out of /28 prefixes delegated to network interfaces
+	ModePrefix Mode = "prefix"
+
+	// Pod limit of a node when none is configured, the kubelet default
+	DefaultMaxPodsPerNode = 110
+)
+
+// VPC CNI settings deciding how many addresses a node holds on to for its pods,
+// mirroring the WARM_IP_TARGET, MINIMUM_IP_TARGET, WARM_PREFIX_TARGET and
+// ENABLE_POD_ENI environment variables of the aws-node daemonset
+type CNIConfig struct {
+	Mode             Mode
+	WarmIPTarget     int
+	MinimumIPTarget  int
+	WarmPrefixTarget int
+	MaxPodsPerNode   int
+	// Security groups for pods, every node gets a trunk network interface
+	PodENI bool
+	// Share of pods using security groups for pods, each holding a branch network interface
+	BranchPodRatio float64
+}
+
+func (c CNIConfig) Validate() error {
+	if c.Mode != ModeSecondaryIP && c.Mode != ModePrefix {
+		return fmt.Errorf("invalid CNI mode %q, must be %q or %q", c.Mode, ModeSecondaryIP, ModePrefix)
+	}
+	if c.WarmIPTarget < 0 || c.MinimumIPTarget < 0 || c.WarmPrefixTarget < 0 {
+		return fmt.Errorf("CNI warm targets must not be negative")
+	}
+	if c.MaxPodsPerNode < 1 {
+		return fmt.Errorf("max pods per node must be at least 1")
+	}
+	if c.BranchPodRatio < 0 || c.BranchPodRatio > 1 {
+		return fmt.Errorf("branch pod ratio must be between 0 and 1")
+	}
+	if c.BranchPodRatio > 0 && !c.PodENI {
+		return fmt.Errorf("branch pod ratio requires pod ENI to be enabled")
+	}
+	return nil
+}
+
+// Pods out of the given number that run with a branch network interface
+func (c CNIConfig) branchPods(pods int) int {
+	if !c.PodENI {
+		return 0
+	}
+	return int(math.Round(float64(pods) * c.BranchPodRatio))
+}
+
+// Secondary IPs and prefixes the CNI holds on a node running the given number of pods.
+// Pods with a branch network interface take a single IP from the subnet each, in prefix
+// mode as well, and are not covered by the warm targets.
+func (c CNIConfig) addressesPerNode(pods int) (ips int, prefixes int) {
+	branchPods := c.branchPods(pods)
+	pods -= branchPods
+
+	ipTargets := c.WarmIPTarget > 0 || c.MinimumIPTarget > 0
+	podIPs := pods + c.WarmIPTarget
+	if podIPs < c.MinimumIPTarget {
+		podIPs = c.MinimumIPTarget
+	}
+
+	if c.Mode == ModeSecondaryIP {
+		return podIPs + branchPods, 0
+	}
+	// WARM_IP_TARGET and MINIMUM_IP_TARGET take precedence over WARM_PREFIX_TARGET
+	if ipTargets {
+		return branchPods, ceilDiv(podIPs, utils.IPsPerPrefix)
+	}
+	return branchPods, ceilDiv(pods, utils.IPsPerPrefix) + c.WarmPrefixTarget
+}
+
+func ceilDiv(a, b int) int {
+	return (a + b - 1) / b
+}
@@ -0,0 +1,77 @@
+package capacity
+
+import (
+	"fmt"
+)
+
+// Network interface limits of an EC2 instance type
+type InstanceLimits struct {
+	ENIs      int
+	IPsPerENI int
+}
+
+// Network interface limits of common instance types, see
+// https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/using-eni.html#AvailableIpPerENI
+var instanceLimits = map[string]InstanceLimits{
+	"t3.micro":   {ENIs: 2, IPsPerENI: 2},
+	"t3.small":   {ENIs: 3, IPsPerENI: 4},
+	"t3.medium":  {ENIs: 3, IPsPerENI: 6},
+	"t3.large":   {ENIs: 3, IPsPerENI: 12},
+	"t3.xlarge":  {ENIs: 4, IPsPerENI: 15},
+	"t3.2xlarge": {ENIs: 4, IPsPerENI: 15},
+
+	"m5.large":    {ENIs: 3, IPsPerENI: 10},
+	"m5.xlarge":   {ENIs: 4, IPsPerENI: 15},
+	"m5.2xlarge":  {ENIs: 4, IPsPerENI: 15},
+	"m5.4xlarge":  {ENIs: 8, IPsPerENI: 30},
+	"m5.8xlarge":  {ENIs: 8, IPsPerENI: 30},
+	"m5.12xlarge": {ENIs: 8, IPsPerENI: 30},
+	"m5.16xlarge": {ENIs: 15, IPsPerENI: 50},
+	"m5.24xlarge": {ENIs: 15, IPsPerENI: 50},
+
+	"m6i.large":    {ENIs: 3, IPsPerENI: 10},
+	"m6i.xlarge":   {ENIs: 4, IPsPerENI: 15},
+	"m6i.2xlarge":  {ENIs: 4, IPsPerENI: 15},
+	"m6i.4xlarge":  {ENIs: 8, IPsPerENI: 30},
+	"m6i.8xlarge":  {ENIs: 8, IPsPerENI: 30},
+	"m6i.12xlarge": {ENIs: 8, IPsPerENI: 30},
+	"m6i.16xlarge": {ENIs: 15, IPsPerENI: 50},
+	"m6i.24xlarge": {ENIs: 15, IPsPerENI: 50},
+	"m6i.32xlarge": {ENIs: 15, IPsPerENI: 50},
+
+	"m6g.medium":   {ENIs: 2, IPsPerENI: 4},
+	"m6g.large":    {ENIs: 3, IPsPerENI: 10},
+	"m6g.xlarge":   {ENIs: 4, IPsPerENI: 15},
+	"m6g.2xlarge":  {ENIs: 4, IPsPerENI: 15},
+	"m6g.4xlarge":  {ENIs: 8, IPsPerENI: 30},
+	"m6g.8xlarge":  {ENIs: 8, IPsPerENI: 30},
+	"m6g.12xlarge": {ENIs: 8, IPsPerENI: 30},
+	"m6g.16xlarge": {ENIs: 15, IPsPerENI: 50},
+
+	"c5.large":    {ENIs: 3, IPsPerENI: 10},
+	"c5.xlarge":   {ENIs: 4, IPsPerENI: 15},
+	"c5.2xlarge":  {ENIs: 4, IPsPerENI: 15},
+	"c5.4xlarge":  {ENIs: 8, IPsPerENI: 30},
+	"c5.9xlarge":  {ENIs: 8, IPsPerENI: 30},
+	"c5.12xlarge": {ENIs: 8, IPsPerENI: 30},
+	"c5.18xlarge": {ENIs: 15, IPsPerENI: 50},
+	"c5.24xlarge": {ENIs: 15, IPsPerENI: 50},
+
+	"r5.large":    {ENIs: 3, IPsPerENI: 10},
+	"r5.xlarge":   {ENIs: 4, IPsPerENI: 15},
+	"r5.2xlarge":  {ENIs: 4, IPsPerENI: 15},
+	"r5.4xlarge":  {ENIs: 8, IPsPerENI: 30},
+	"r5.8xlarge":  {ENIs: 8, IPsPerENI: 30},
+	"r5.12xlarge": {ENIs: 8, IPsPerENI: 30},
+	"r5.16xlarge": {ENIs: 15, IPsPerENI: 50},
+	"r5.24xlarge": {ENIs: 15, IPsPerENI: 50},
+}
+
+// Look up the network interface limits of an instance type
+func GetInstanceLimits(instanceType string) (InstanceLimits, error) {
+	limits, ok := instanceLimits[instanceType]
+	if !ok {
+		return InstanceLimits{}, fmt.Errorf("unknown instance type: %s", instanceType)
+	}
+	return limits, nil
+}
@@ -0,0 +1,52 @@
+package capacity
+
+import (
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/aws"
+)
+
+// Secondary IPs and prefixes the CNI attaches to a node of the instance type when it
+// boots, before any pod is scheduled. The primary IP of the node comes on top.
+func (c CNIConfig) bootAddresses(limits InstanceLimits) (ips int, prefixes int) {
+	enis := limits.ENIs
+	trunkIPs := 0
+	if c.PodENI {
+		// the trunk network interface takes an interface slot and its primary IP
+		enis--
+		trunkIPs = 1
+	}
+	// the primary IP of every network interface can not be handed to pods
+	maxSlots := enis * (limits.IPsPerENI - 1)
+	if c.Mode == ModePrefix {
+		_, prefixes = c.addressesPerNode(0)
+		if prefixes > maxSlots {
+			prefixes = maxSlots
+		}
+		return trunkIPs, prefixes
+	}
+
+	ips, _ = c.addressesPerNode(0)
+	if c.WarmIPTarget == 0 && c.MinimumIPTarget == 0 {
+		// WARM_ENI_TARGET fills the primary network interface with secondary IPs
+		ips = limits.IPsPerENI - 1
+	}
+	if ips > maxSlots {
+		ips = maxSlots
+	}
+	return ips + trunkIPs, 0
+}
+
+// Estimate how many more nodes of the instance type can launch into the subnet, counting
+// the primary IP of each node and the addresses the CNI attaches to it at boot
+func NodeHeadroom(s aws.Subnet, cfg CNIConfig, limits InstanceLimits) int {
+	ips, prefixes := cfg.bootAddresses(limits)
+	headroom := int(s.AvailableIPs) / ipsPerNode(ips, prefixes)
+	if prefixes > 0 {
+		if byPrefixes := len(s.AvailablePrefixes) / prefixes; byPrefixes < headroom {
+			headroom = byPrefixes
+		}
+	}
+	if headroom < 0 {
+		return 0
+	}
+	return headroom
+}
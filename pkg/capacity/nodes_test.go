@@ -0,0 +1,66 @@
+package capacity
+
+import (
+	"testing"
+
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/aws"
+)
+
+func TestNodeHeadroom(t *testing.T) {
+	subnet := aws.Subnet{
+		AvailableIPs:      100,
+		AvailablePrefixes: make([]string, 4),
+	}
+
+	tests := []struct {
+		name         string
+		cfg          CNIConfig
+		instanceType string
+		want         int
+	}{
+		{
+			name:         "Secondary IPs fill the primary network interface",
+			cfg:          CNIConfig{Mode: ModeSecondaryIP, MaxPodsPerNode: 110},
+			instanceType: "m5.large",
+			// primary IP and 9 secondary IPs per node
+			want: 10,
+		},
+		{
+			name:         "Secondary IPs with warm IP target",
+			cfg:          CNIConfig{Mode: ModeSecondaryIP, WarmIPTarget: 3, MaxPodsPerNode: 110},
+			instanceType: "m5.large",
+			want:         25,
+		},
+		{
+			name:         "Prefixes limited by available prefixes",
+			cfg:          CNIConfig{Mode: ModePrefix, WarmPrefixTarget: 1, MaxPodsPerNode: 110},
+			instanceType: "m5.xlarge",
+			want:         4,
+		},
+		{
+			name:         "Prefixes limited by available IPs",
+			cfg:          CNIConfig{Mode: ModePrefix, WarmPrefixTarget: 2, MaxPodsPerNode: 110},
+			instanceType: "m5.xlarge",
+			// 33 IPs per node
+			want: 2,
+		},
+		{
+			name:         "Trunk network interface takes an IP",
+			cfg:          CNIConfig{Mode: ModeSecondaryIP, WarmIPTarget: 3, PodENI: true, MaxPodsPerNode: 110},
+			instanceType: "m5.large",
+			want:         20,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limits, err := GetInstanceLimits(tt.instanceType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := NodeHeadroom(subnet, tt.cfg, limits); got != tt.want {
+				t.Errorf("NodeHeadroom() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
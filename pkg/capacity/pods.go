@@ -0,0 +1,51 @@
+package capacity
+
+import (
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/aws"
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/utils"
+)
+
+// Estimate how many more pods fit in the subnet, assuming new nodes are filled up
+// to MaxPodsPerNode and each holds its primary IP and warm addresses on top of the
+// pods it runs, as NodeHeadroom counts them.
+// Secondary IPs, and the IPs of delegated prefixes, come out of the AWS reported
+// available IPs, prefixes out of the computed available prefixes.
+func PodCapacity(s aws.Subnet, cfg CNIConfig) int {
+	return podsFor(int(s.AvailableIPs), len(s.AvailablePrefixes), cfg)
+}
+
+// Pods that fit in the free IPs and prefixes
+func podsFor(freeIPs, freePrefixes int, cfg CNIConfig) int {
+	ips, prefixes := cfg.addressesPerNode(cfg.MaxPodsPerNode)
+	nodes := nodesFor(freeIPs, freePrefixes, ips, prefixes)
+	pods := nodes * cfg.MaxPodsPerNode
+
+	// a last node only partly filled
+	freeIPs -= nodes * ipsPerNode(ips, prefixes)
+	freePrefixes -= nodes * prefixes
+	for p := cfg.MaxPodsPerNode - 1; p > 0; p-- {
+		ips, prefixes := cfg.addressesPerNode(p)
+		if nodesFor(freeIPs, freePrefixes, ips, prefixes) > 0 {
+			pods += p
+			break
+		}
+	}
+	return pods
+}
+
+// Nodes holding the given secondary IPs and prefixes each that fit in the free IPs and prefixes
+func nodesFor(freeIPs, freePrefixes, ips, prefixes int) int {
+	if freeIPs <= 0 {
+		return 0
+	}
+	nodes := freeIPs / ipsPerNode(ips, prefixes)
+	if prefixes > 0 && freePrefixes/prefixes < nodes {
+		nodes = freePrefixes / prefixes
+	}
+	return nodes
+}
+
+// IPs a node takes out of the subnet, its primary IP on top of the secondary IPs and prefixes
+func ipsPerNode(ips, prefixes int) int {
+	return 1 + ips + prefixes*utils.IPsPerPrefix
+}
@@ -0,0 +1,97 @@
+package capacity
+
+import (
+	"testing"
+
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/aws"
+)
+
+func TestPodCapacity(t *testing.T) {
+	subnet := aws.Subnet{
+		AvailableIPs:      250,
+		AvailablePrefixes: make([]string, 20),
+	}
+	prefixSubnet := aws.Subnet{
+		AvailableIPs:      400,
+		AvailablePrefixes: make([]string, 20),
+	}
+
+	tests := []struct {
+		name   string
+		subnet aws.Subnet
+		cfg    CNIConfig
+		want   int
+	}{
+		{
+			name:   "Secondary IPs without warm targets",
+			subnet: subnet,
+			cfg:    CNIConfig{Mode: ModeSecondaryIP, MaxPodsPerNode: 110},
+			// a full node holds 111 IPs with its primary IP, the remaining 28 IPs fit 27 pods
+			want: 247,
+		},
+		{
+			name:   "Secondary IPs with warm IP target",
+			subnet: subnet,
+			cfg:    CNIConfig{Mode: ModeSecondaryIP, WarmIPTarget: 5, MaxPodsPerNode: 110},
+			// two full nodes use 232 IPs, the remaining 18 fit a primary IP, 12 pods and 5 warm IPs
+			want: 232,
+		},
+		{
+			name:   "Prefixes with warm prefix target",
+			subnet: prefixSubnet,
+			cfg:    CNIConfig{Mode: ModePrefix, WarmPrefixTarget: 1, MaxPodsPerNode: 110},
+			// a full node holds 7 prefixes and a warm one, the remaining 4 prefixes fit 48 pods
+			want: 268,
+		},
+		{
+			name:   "Prefixes with minimum IP target",
+			subnet: prefixSubnet,
+			cfg:    CNIConfig{Mode: ModePrefix, WarmPrefixTarget: 1, MinimumIPTarget: 200, MaxPodsPerNode: 110},
+			// a node holds at least 13 prefixes whatever it runs
+			want: 110,
+		},
+		{
+			name:   "Prefixes limited by available IPs",
+			subnet: subnet,
+			cfg:    CNIConfig{Mode: ModePrefix, WarmPrefixTarget: 1, MaxPodsPerNode: 110},
+			// a full node holds 8 prefixes and its primary IP, 129 IPs, the remaining 121 IPs
+			// fit 7 prefixes and 96 pods
+			want: 206,
+		},
+		{
+			name:   "Prefixes limited by primary IPs",
+			subnet: aws.Subnet{AvailableIPs: 386, AvailablePrefixes: make([]string, 30)},
+			cfg:    CNIConfig{Mode: ModePrefix, WarmPrefixTarget: 1, MaxPodsPerNode: 110},
+			// 386 IPs would fit the 128 IPs of 3 full nodes, but with their primary IPs only
+			// 2 fit and the remaining 128 IPs fit 7 prefixes and 96 pods
+			want: 316,
+		},
+		{
+			name:   "Secondary IPs with branch pods",
+			subnet: subnet,
+			cfg:    CNIConfig{Mode: ModeSecondaryIP, WarmIPTarget: 10, PodENI: true, BranchPodRatio: 0.5, MaxPodsPerNode: 100},
+			// branch pods are not covered by the warm IP target, a full node holds 111 IPs
+			// and the remaining 28 IPs fit 8 branch and 9 regular pods
+			want: 217,
+		},
+		{
+			name:   "Prefixes with branch pods",
+			subnet: prefixSubnet,
+			cfg:    CNIConfig{Mode: ModePrefix, WarmPrefixTarget: 1, PodENI: true, BranchPodRatio: 0.5, MaxPodsPerNode: 100},
+			// branch pods take single IPs, a full node holds 5 prefixes and 50 IPs, 130 IPs in
+			// total, so IPs run out after 3 nodes
+			want: 300,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			if got := PodCapacity(tt.subnet, tt.cfg); got != tt.want {
+				t.Errorf("PodCapacity() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package events
+
+import (
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/aws"
+)
+
+// Tracker remembers the previous refresh of subnets to diff the next one against
+type Tracker struct {
+	bands    []float64
+	previous map[string]aws.Subnet
+	// Utilization band last reported for every subnet, keyed by subnet ID
+	levels map[string]float64
+}
+
+func NewTracker(bands []float64) *Tracker {
+	return &Tracker{bands: bands}
+}
+
+// Diff the subnets against the previous refresh. The first refresh is the baseline
+// and produces no events.
+func (t *Tracker) Observe(subnets []aws.Subnet, now time.Time) []Event {
+	current := make(map[string]aws.Subnet, len(subnets))
+	for _, s := range subnets {
+		current[s.SubnetID] = s
+	}
+	previous := t.previous
+	t.previous = current
+	if previous == nil {
+		t.levels = make(map[string]float64, len(current))
+		for id, s := range current {
+			t.levels[id] = band(s.UtilizationRatio(), t.bands)
+		}
+		return nil
+	}
+
+	events := Diff(previous, current, now)
+	for id, s := range current {
+		level, ok := t.levels[id]
+		if !ok {
+			t.levels[id] = band(s.UtilizationRatio(), t.bands)
+			continue
+		}
+		if next := nextBand(level, s.UtilizationRatio(), t.bands); next != level {
+			events = append(events, newEvent(TypeUtilizationBand, s, now, level, next))
+			t.levels[id] = next
+		}
+	}
+	for id := range previous {
+		if _, ok := current[id]; !ok {
+			delete(t.levels, id)
+		}
+	}
+	sortEvents(events)
+	return events
+}
+
+// Events turning the previous subnets into the current ones, both keyed by subnet ID.
+// Utilization bands are left to the Tracker as crossing one depends on the band last
+// reported rather than the previous refresh alone.
+func Diff(previous, current map[string]aws.Subnet, now time.Time) []Event {
+	var events []Event
+	for id, s := range current {
+		old, ok := previous[id]
+		if !ok {
+			events = append(events, newEvent(TypeSubnetAdded, s, now, nil, s.CIDRBlock))
+			continue
+		}
+		if !sameTags(old.Tags, s.Tags) {
+			events = append(events, newEvent(TypeTagsChanged, s, now, old.Tags, s.Tags))
+		}
+		if oldCIDRs, newCIDRs := cidrBlocks(old), cidrBlocks(s); !reflect.DeepEqual(oldCIDRs, newCIDRs) {
+			events = append(events, newEvent(TypeCIDRChanged, s, now, oldCIDRs, newCIDRs))
+		}
+	}
+	for id, s := range previous {
+		if _, ok := current[id]; !ok {
+			events = append(events, newEvent(TypeSubnetRemoved, s, now, s.CIDRBlock, nil))
+		}
+	}
+	sortEvents(events)
+	return events
+}
+
+// Order events by subnet and then type so every refresh lists them the same way
+func sortEvents(events []Event) {
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].SubnetID != events[j].SubnetID {
+			return events[i].SubnetID < events[j].SubnetID
+		}
+		return events[i].Type < events[j].Type
+	})
+}
+
+// IPv4 and IPv6 CIDR blocks associated with the subnet
+func cidrBlocks(s aws.Subnet) []string {
+	cidrs := append([]string{s.CIDRBlock}, s.IPv6CIDRBlocks...)
+	sort.Strings(cidrs[1:])
+	return cidrs
+}
+
+func newEvent(eventType string, s aws.Subnet, now time.Time, old, new interface{}) Event {
+	return Event{
+		Type:     eventType,
+		Time:     now,
+		SubnetID: s.SubnetID,
+		Name:     s.Name,
+		VPCID:    s.VPCID,
+		AZ:       s.AZ,
+		Old:      old,
+		New:      new,
+	}
+}
@@ -0,0 +1,104 @@
+package events
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/aws"
+)
+
+func TestObserve(t *testing.T) {
+	bands, err := ParseBands(DefaultUtilizationBands)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker := NewTracker(bands)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	first := []aws.Subnet{
+		{SubnetID: "subnet-1", CIDRBlock: "10.0.0.0/24", Tags: map[string]string{"tier": "private"}, TotalIPs: 256, AllocatedIPs: 100},
+		{SubnetID: "subnet-2", CIDRBlock: "10.0.1.0/24", TotalIPs: 256, AllocatedIPs: 10},
+	}
+	if events := tracker.Observe(first, now); len(events) != 0 {
+		t.Errorf("first Observe() = %+v, want no events", events)
+	}
+
+	second := []aws.Subnet{
+		{SubnetID: "subnet-1", CIDRBlock: "10.0.0.0/24", Tags: map[string]string{"tier": "public"}, TotalIPs: 256, AllocatedIPs: 240},
+		{SubnetID: "subnet-3", CIDRBlock: "10.0.2.0/24", TotalIPs: 256},
+	}
+	var got [][3]interface{}
+	for _, e := range tracker.Observe(second, now) {
+		got = append(got, [3]interface{}{e.SubnetID, e.Type, e.New})
+	}
+	want := [][3]interface{}{
+		{"subnet-1", TypeTagsChanged, map[string]string{"tier": "public"}},
+		{"subnet-1", TypeUtilizationBand, 0.9},
+		{"subnet-2", TypeSubnetRemoved, nil},
+		{"subnet-3", TypeSubnetAdded, "10.0.2.0/24"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Observe() = %v, want %v", got, want)
+	}
+
+	if events := tracker.Observe(second, now); len(events) != 0 {
+		t.Errorf("Observe() of an unchanged refresh = %+v, want no events", events)
+	}
+}
+
+func TestObserveBandHysteresis(t *testing.T) {
+	tracker := NewTracker([]float64{0.5, 0.9})
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		allocated int
+		want      []float64
+	}{
+		{allocated: 228},
+		// rises into the 0.9 band at 231 of 256 IPs
+		{allocated: 231, want: []float64{0.9}},
+		// dips just below the edge, within the margin
+		{allocated: 229},
+		{allocated: 231},
+		// falls below the edge by more than the margin
+		{allocated: 224, want: []float64{0.5}},
+		{allocated: 40, want: []float64{0}},
+	}
+	for i, tt := range tests {
+		subnets := []aws.Subnet{{SubnetID: "subnet-1", TotalIPs: 256, AllocatedIPs: tt.allocated}}
+		var got []float64
+		for _, e := range tracker.Observe(subnets, now) {
+			got = append(got, e.New.(float64))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Observe() refresh %d with %d IPs allocated = %v, want %v", i, tt.allocated, got, tt.want)
+		}
+	}
+}
+
+func TestParseBands(t *testing.T) {
+	got, err := ParseBands("0.9, 0.5")
+	if err != nil || !reflect.DeepEqual(got, []float64{0.5, 0.9}) {
+		t.Errorf("ParseBands() = %v, %v, want [0.5 0.9]", got, err)
+	}
+	for _, invalid := range []string{"0", "1", "half"} {
+		if _, err := ParseBands(invalid); err == nil {
+			t.Errorf("ParseBands(%q) returned no error", invalid)
+		}
+	}
+}
+
+func TestDiffCIDRAssociations(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	previous := map[string]aws.Subnet{"subnet-1": {SubnetID: "subnet-1", CIDRBlock: "10.0.0.0/24"}}
+	current := map[string]aws.Subnet{"subnet-1": {SubnetID: "subnet-1", CIDRBlock: "10.0.0.0/24", IPv6CIDRBlocks: []string{"2a05:d01c::/64"}}}
+
+	events := Diff(previous, current, now)
+	if len(events) != 1 || events[0].Type != TypeCIDRChanged {
+		t.Fatalf("Diff() = %+v, want one %s event", events, TypeCIDRChanged)
+	}
+	if want := []string{"10.0.0.0/24", "2a05:d01c::/64"}; !reflect.DeepEqual(events[0].New, want) {
+		t.Errorf("Diff() new CIDR blocks = %v, want %v", events[0].New, want)
+	}
+}
@@ -0,0 +1,85 @@
+package events
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/utils"
+)
+
+// Kinds of subnet state changes
+const (
+	TypeSubnetAdded     = "subnet_added"
+	TypeSubnetRemoved   = "subnet_removed"
+	TypeTagsChanged     = "tags_changed"
+	TypeCIDRChanged     = "cidr_changed"
+	TypeUtilizationBand = "utilization_band_changed"
+)
+
+const (
+	// Utilization ratios marking the edges of the bands crossing one raises an event
+	DefaultUtilizationBands = "0.5,0.75,0.9"
+	// How far the ratio has to drop below the edge of a band before leaving it, so a
+	// subnet hovering around an edge does not raise an event on every refresh
+	bandMargin = 0.02
+)
+
+// Change in the state of a subnet between two refreshes
+type Event struct {
+	Type     string    `json:"type"`
+	Time     time.Time `json:"time"`
+	SubnetID string    `json:"subnetId"`
+	Name     string    `json:"name"`
+	VPCID    string    `json:"vpcId"`
+	AZ       string    `json:"az"`
+	// State before and after the change, e.g. the tags or the utilization band
+	Old interface{} `json:"old,omitempty"`
+	New interface{} `json:"new,omitempty"`
+}
+
+// Parse comma separated utilization ratios between 0 and 1 that mark the band edges
+func ParseBands(s string) ([]float64, error) {
+	var bands []float64
+	for _, item := range utils.SplitList(s) {
+		band, err := strconv.ParseFloat(item, 64)
+		if err != nil || band <= 0 || band >= 1 {
+			return nil, fmt.Errorf("invalid utilization band %q, must be between 0 and 1", item)
+		}
+		bands = append(bands, band)
+	}
+	sort.Float64s(bands)
+	return bands, nil
+}
+
+// Lower edge of the utilization band the ratio falls in, 0 below the first edge
+func band(ratio float64, bands []float64) float64 {
+	lower := 0.0
+	for _, b := range bands {
+		if ratio >= b {
+			lower = b
+		}
+	}
+	return lower
+}
+
+// Band to report after the one last reported, rising into a higher band right away but
+// only falling back once the ratio is below the edge by more than the margin
+func nextBand(level, ratio float64, bands []float64) float64 {
+	if next := band(ratio, bands); next >= level {
+		return next
+	}
+	if next := band(ratio+bandMargin, bands); next < level {
+		return next
+	}
+	return level
+}
+
+func sameTags(a, b map[string]string) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
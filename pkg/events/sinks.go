@@ -0,0 +1,139 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	sinkStdout  = "stdout"
+	sinkFile    = "file:"
+	sinkWebhook = "webhook:"
+
+	requestTimeout = 10 * time.Second
+)
+
+// Destination of subnet events
+type Sink interface {
+	Send(ctx context.Context, events []Event) error
+}
+
+// Sink writing every event as a line of JSON
+type WriterSink struct {
+	w io.Writer
+}
+
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+func (s *WriterSink) Send(_ context.Context, events []Event) error {
+	enc := json.NewEncoder(s.w)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return errors.Wrap(err, "cannot write event")
+		}
+	}
+	return nil
+}
+
+// Open a JSON lines file to append events to
+func NewFileSink(path string) (*WriterSink, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot open event file")
+	}
+	return NewWriterSink(f), nil
+}
+
+// Sink posting the events of a refresh as a JSON array
+type WebhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookSink(url string) *WebhookSink {
+	return &WebhookSink{url: url, client: &http.Client{Timeout: requestTimeout}}
+}
+
+func (s *WebhookSink) Send(ctx context.Context, events []Event) error {
+	body, err := json.Marshal(events)
+	if err != nil {
+		return errors.Wrap(err, "cannot encode events")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "cannot create event webhook request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		// keep webhook URLs, which may hold tokens, out of the logs
+		if urlErr, ok := err.(*neturl.Error); ok {
+			err = urlErr.Err
+		}
+		return errors.Wrapf(err, "cannot post events to webhook on %s", req.URL.Host)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("event webhook on %s returned %s", req.URL.Host, resp.Status)
+	}
+	return nil
+}
+
+// Split a list of sinks on the commas that start a new sink, so a comma in a path or
+// in the query of a webhook URL stays part of it
+func splitSinks(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		trimmed := strings.TrimSpace(item)
+		if trimmed == "" {
+			continue
+		}
+		newSink := trimmed == sinkStdout || strings.HasPrefix(trimmed, sinkFile) || strings.HasPrefix(trimmed, sinkWebhook)
+		if last := len(items) - 1; !newSink && last >= 0 && items[last] != sinkStdout {
+			items[last] += "," + strings.TrimRightFunc(item, unicode.IsSpace)
+			continue
+		}
+		items = append(items, trimmed)
+	}
+	return items
+}
+
+// Parse comma separated sinks: stdout, file:<path> or webhook:<url>
+func ParseSinks(s string) ([]Sink, error) {
+	var sinks []Sink
+	for i, item := range splitSinks(s) {
+		switch {
+		case item == sinkStdout:
+			sinks = append(sinks, NewWriterSink(os.Stdout))
+		case strings.HasPrefix(item, sinkFile):
+			sink, err := NewFileSink(strings.TrimPrefix(item, sinkFile))
+			if err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, sink)
+		case strings.HasPrefix(item, sinkWebhook):
+			url := strings.TrimPrefix(item, sinkWebhook)
+			if u, err := neturl.Parse(url); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				// point at the sink by its position, webhook URLs may hold tokens
+				return nil, fmt.Errorf("invalid URL of event sink %d, must be an http or https URL", i)
+			}
+			sinks = append(sinks, NewWebhookSink(url))
+		default:
+			return nil, fmt.Errorf("invalid event sink %q, must be stdout, file:<path> or webhook:<url>", item)
+		}
+	}
+	return sinks, nil
+}
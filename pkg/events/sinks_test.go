@@ -0,0 +1,107 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testEvents = []Event{
+	{Type: TypeSubnetAdded, SubnetID: "subnet-1"},
+	{Type: TypeSubnetRemoved, SubnetID: "subnet-2"},
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	sinks, err := ParseSinks("file:" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := sinks[0].Send(context.Background(), testEvents); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	lines := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("invalid line %s: %v", scanner.Text(), err)
+		}
+		lines++
+	}
+	if lines != 4 {
+		t.Errorf("file holds %d events, want 4", lines)
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	var received []Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	sinks, err := ParseSinks("webhook:" + server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sinks[0].Send(context.Background(), testEvents); err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 2 || received[1].SubnetID != "subnet-2" {
+		t.Errorf("webhook received %+v", received)
+	}
+}
+
+func TestSplitSinks(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"stdout, file:/tmp/events.jsonl", []string{"stdout", "file:/tmp/events.jsonl"}},
+		{"webhook:https://example.com/hook?tags=a,b,c,stdout", []string{"webhook:https://example.com/hook?tags=a,b,c", "stdout"}},
+		{"file:/tmp/a,b.jsonl, webhook:https://example.com/hook?x=1,2", []string{"file:/tmp/a,b.jsonl", "webhook:https://example.com/hook?x=1,2"}},
+		{"stdout,stderr", []string{"stdout", "stderr"}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := splitSinks(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitSinks(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseSinksInvalid(t *testing.T) {
+	for _, invalid := range []string{"stderr", "stdout,stderr", "webhook:example.com", "file:/nonexistent/dir/events.jsonl"} {
+		if _, err := ParseSinks(invalid); err == nil {
+			t.Errorf("ParseSinks(%q) returned no error", invalid)
+		}
+	}
+}
+
+func TestParseSinksHidesWebhookURL(t *testing.T) {
+	_, err := ParseSinks("stdout,webhook:ftp://hooks.example.com/secret-token")
+	if err == nil {
+		t.Fatal("ParseSinks() returned no error")
+	}
+	if strings.Contains(err.Error(), "secret-token") {
+		t.Errorf("ParseSinks() error %q shows the webhook URL", err)
+	}
+}
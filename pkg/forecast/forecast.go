@@ -0,0 +1,161 @@
+package forecast
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/aws"
+)
+
+const (
+	// Samples needed before a trend is fitted
+	MinSamples = 5
+	// Samples a trend is fitted to, longer histories are thinned evenly to keep the fit cheap
+	maxFitSamples = 200
+	// Longest exhaustion time a duration can hold
+	maxExhaustionSeconds = float64(math.MaxInt64 / int64(time.Second))
+
+	ResourceIPs      = "ips"
+	ResourcePrefixes = "prefixes"
+)
+
+type sample struct {
+	time         time.Time
+	freeIPs      float64
+	freePrefixes float64
+}
+
+// Rolling history of the free capacity of every subnet
+type Forecaster struct {
+	lookback time.Duration
+	history  map[string][]sample
+}
+
+// Predicted time until a subnet runs out of a resource
+type Prediction struct {
+	SubnetID string
+	Resource string
+	// Rate of change of free capacity per second, negative while it shrinks
+	Slope      float64
+	Exhaustion time.Duration
+}
+
+func NewForecaster(lookback time.Duration) *Forecaster {
+	return &Forecaster{lookback: lookback, history: map[string][]sample{}}
+}
+
+// Add the free IPs and prefixes of the subnets to the history, dropping samples older
+// than the lookback window and subnets that no longer exist
+func (f *Forecaster) Record(subnets []aws.Subnet, now time.Time) {
+	seen := map[string]bool{}
+	cutoff := now.Add(-f.lookback)
+	for _, s := range subnets {
+		seen[s.SubnetID] = true
+		samples := append(f.history[s.SubnetID], sample{
+			time:         now,
+			freeIPs:      s.AvailableIPs,
+			freePrefixes: float64(len(s.AvailablePrefixes)),
+		})
+		i := 0
+		for i < len(samples) && samples[i].time.Before(cutoff) {
+			i++
+		}
+		f.history[s.SubnetID] = samples[i:]
+	}
+	for id := range f.history {
+		if !seen[id] {
+			delete(f.history, id)
+		}
+	}
+}
+
+// Predict when the free IPs and prefixes of each subnet run out. Subnets with too few
+// samples or whose free capacity is not shrinking get no prediction.
+func (f *Forecaster) Predict(now time.Time) []Prediction {
+	var predictions []Prediction
+	for id, samples := range f.history {
+		if len(samples) < MinSamples {
+			continue
+		}
+		samples = thin(samples, maxFitSamples)
+		for _, resource := range []string{ResourceIPs, ResourcePrefixes} {
+			xs := make([]float64, len(samples))
+			ys := make([]float64, len(samples))
+			for i, s := range samples {
+				xs[i] = s.time.Sub(now).Seconds()
+				ys[i] = s.freeIPs
+				if resource == ResourcePrefixes {
+					ys[i] = s.freePrefixes
+				}
+			}
+			slope, level := theilSen(xs, ys)
+			if slope >= 0 {
+				continue
+			}
+			seconds := math.Max(level, 0) / -slope
+			// a very slow decline would overflow the duration, it is capped at about 292 years
+			seconds = math.Min(seconds, maxExhaustionSeconds)
+			predictions = append(predictions, Prediction{
+				SubnetID:   id,
+				Resource:   resource,
+				Slope:      slope,
+				Exhaustion: time.Duration(seconds * float64(time.Second)),
+			})
+		}
+	}
+	sort.Slice(predictions, func(i, j int) bool {
+		if predictions[i].SubnetID != predictions[j].SubnetID {
+			return predictions[i].SubnetID < predictions[j].SubnetID
+		}
+		return predictions[i].Resource < predictions[j].Resource
+	})
+	return predictions
+}
+
+// Keep at most n samples spread evenly over the history, always keeping the latest
+func thin(samples []sample, n int) []sample {
+	if len(samples) <= n {
+		return samples
+	}
+	thinned := make([]sample, 0, n)
+	step := float64(len(samples)-1) / float64(n-1)
+	for i := 0; i < n; i++ {
+		thinned = append(thinned, samples[int(math.Round(float64(i)*step))])
+	}
+	return thinned
+}
+
+// Fit a line with the Theil-Sen estimator, the median of the slopes between every pair
+// of points. Unlike least squares it is barely moved by the jumps of a sawtooth, such
+// as free IPs coming back when nodes scale down. Returns the slope and the fitted
+// value at x = 0.
+func theilSen(xs, ys []float64) (float64, float64) {
+	var slopes []float64
+	for i := range xs {
+		for j := i + 1; j < len(xs); j++ {
+			if xs[j] != xs[i] {
+				slopes = append(slopes, (ys[j]-ys[i])/(xs[j]-xs[i]))
+			}
+		}
+	}
+	if len(slopes) == 0 {
+		return 0, 0
+	}
+	slope := median(slopes)
+
+	intercepts := make([]float64, len(xs))
+	for i := range xs {
+		intercepts[i] = ys[i] - slope*xs[i]
+	}
+	return slope, median(intercepts)
+}
+
+func median(values []float64) float64 {
+	sort.Float64s(values)
+	mid := len(values) / 2
+	if len(values)%2 == 0 {
+		return (values[mid-1] + values[mid]) / 2
+	}
+	return values[mid]
+}
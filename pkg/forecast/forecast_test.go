@@ -0,0 +1,135 @@
+package forecast
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/aws"
+)
+
+func TestPredict(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		// free IPs of the subnet, one sample per minute
+		freeIPs []float64
+		// predicted minutes until the free IPs run out, negative for no prediction
+		want float64
+	}{
+		{
+			name:    "too few samples",
+			freeIPs: []float64{100, 99, 98},
+			want:    -1,
+		},
+		{
+			name:    "steady decline",
+			freeIPs: []float64{100, 99, 98, 97, 96, 95, 94, 93, 92, 91},
+			want:    91,
+		},
+		{
+			name:    "growing",
+			freeIPs: []float64{90, 91, 92, 93, 94, 95},
+			want:    -1,
+		},
+		{
+			// 2 IPs a minute are taken and nodes scaling down hand 15 back every 10 minutes,
+			// free IPs shrink by half an IP a minute in the long run
+			name:    "sawtooth",
+			freeIPs: sawtooth(200, 60, 10, -2, 15),
+			want:    310,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewForecaster(time.Hour)
+			var now time.Time
+			for i, free := range tt.freeIPs {
+				now = start.Add(time.Duration(i) * time.Minute)
+				f.Record([]aws.Subnet{{SubnetID: "subnet-1", AvailableIPs: free}}, now)
+			}
+
+			var got *Prediction
+			for _, p := range f.Predict(now) {
+				if p.Resource == ResourceIPs {
+					p := p
+					got = &p
+				}
+			}
+			if tt.want < 0 {
+				if got != nil {
+					t.Errorf("Predict() = %+v, want no prediction", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatal("Predict() returned no prediction")
+			}
+			if minutes := got.Exhaustion.Minutes(); math.Abs(minutes-tt.want) > tt.want*0.1 {
+				t.Errorf("Predict() exhaustion in %.1f minutes, want about %.0f", minutes, tt.want)
+			}
+		})
+	}
+}
+
+func TestPredictSlowDecline(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	lookback := 90 * 24 * time.Hour
+	f := NewForecaster(lookback)
+	// a /16 with 60000 free IPs losing a single IP over the whole lookback window
+	var now time.Time
+	for i := 0; i <= 10; i++ {
+		now = start.Add(time.Duration(i) * lookback / 10)
+		free := 60000.0
+		if i > 5 {
+			free--
+		}
+		f.Record([]aws.Subnet{{SubnetID: "subnet-1", AvailableIPs: free}}, now)
+	}
+
+	predictions := f.Predict(now)
+	if len(predictions) == 0 {
+		t.Fatal("Predict() returned no prediction")
+	}
+	for _, p := range predictions {
+		if p.Resource != ResourceIPs {
+			continue
+		}
+		if p.Slope >= 0 {
+			t.Fatalf("Predict() slope = %v, want a negative slope", p.Slope)
+		}
+		if p.Exhaustion <= 0 {
+			t.Errorf("Predict() exhaustion = %v, want a positive duration", p.Exhaustion)
+		}
+	}
+}
+
+func sawtooth(start float64, samples, period int, step, jump float64) []float64 {
+	values := make([]float64, samples)
+	value := start
+	for i := range values {
+		values[i] = value
+		if i%period == period-1 {
+			value += jump
+		}
+		value += step
+	}
+	return values
+}
+
+func TestRecordLookback(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := NewForecaster(10 * time.Minute)
+	for i := 0; i < 30; i++ {
+		f.Record([]aws.Subnet{{SubnetID: "subnet-1"}, {SubnetID: "subnet-2"}}, start.Add(time.Duration(i)*time.Minute))
+	}
+	if n := len(f.history["subnet-1"]); n != 11 {
+		t.Errorf("history holds %d samples, want 11", n)
+	}
+
+	f.Record([]aws.Subnet{{SubnetID: "subnet-1"}}, start.Add(30*time.Minute))
+	if _, ok := f.history["subnet-2"]; ok {
+		t.Error("history still holds a subnet that no longer exists")
+	}
+}
@@ -0,0 +1,318 @@
+package generate
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	prom "github.com/ministryofjustice/aws-subnet-exporter/pkg/prometheus"
+	"github.com/pkg/errors"
+)
+
+const (
+	datasourceVariable = "datasource"
+	dashboardWidth     = 24
+)
+
+// Settings of the generated Grafana dashboard
+type DashboardOptions struct {
+	Title string
+	UID   string
+	// Labels holding the AWS account and region, usually set with -const-labels
+	AccountLabel string
+	RegionLabel  string
+}
+
+// Template variable and the label it filters on
+type variable struct {
+	name  string
+	label string
+}
+
+// Grafana dashboard JSON model, only the fields the generator sets
+type Dashboard struct {
+	UID           string      `json:"uid,omitempty"`
+	Title         string      `json:"title"`
+	Tags          []string    `json:"tags"`
+	Timezone      string      `json:"timezone"`
+	SchemaVersion int         `json:"schemaVersion"`
+	Refresh       string      `json:"refresh"`
+	Time          timeRange   `json:"time"`
+	Templating    templating  `json:"templating"`
+	Panels        []panel     `json:"panels"`
+	Annotations   annotations `json:"annotations"`
+}
+
+type timeRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type templating struct {
+	List []templateVariable `json:"list"`
+}
+
+type templateVariable struct {
+	Name       string      `json:"name"`
+	Label      string      `json:"label,omitempty"`
+	Type       string      `json:"type"`
+	Query      interface{} `json:"query"`
+	Datasource *datasource `json:"datasource,omitempty"`
+	Refresh    int         `json:"refresh,omitempty"`
+	IncludeAll bool        `json:"includeAll,omitempty"`
+	AllValue   string      `json:"allValue,omitempty"`
+	Multi      bool        `json:"multi,omitempty"`
+	Sort       int         `json:"sort,omitempty"`
+}
+
+type annotations struct {
+	List []interface{} `json:"list"`
+}
+
+type datasource struct {
+	Type string `json:"type"`
+	UID  string `json:"uid"`
+}
+
+type gridPos struct {
+	H int `json:"h"`
+	W int `json:"w"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type target struct {
+	RefID        string `json:"refId"`
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat,omitempty"`
+	Format       string `json:"format,omitempty"`
+	Instant      bool   `json:"instant,omitempty"`
+}
+
+type panel struct {
+	ID              int                    `json:"id"`
+	Type            string                 `json:"type"`
+	Title           string                 `json:"title"`
+	Description     string                 `json:"description,omitempty"`
+	GridPos         gridPos                `json:"gridPos"`
+	Datasource      *datasource            `json:"datasource,omitempty"`
+	Targets         []target               `json:"targets,omitempty"`
+	Transformations []transformation       `json:"transformations,omitempty"`
+	FieldConfig     map[string]interface{} `json:"fieldConfig,omitempty"`
+	Collapsed       bool                   `json:"collapsed,omitempty"`
+	Panels          []panel                `json:"panels,omitempty"`
+}
+
+type transformation struct {
+	ID      string                 `json:"id"`
+	Options map[string]interface{} `json:"options"`
+}
+
+// Builds panels row by row, resolving metric names and filters from the definitions
+type dashboardBuilder struct {
+	variables []variable
+	panels    []panel
+	nextID    int
+	x, y, h   int
+	err       error
+}
+
+// Build a Grafana dashboard for the metrics registered in pkg/prometheus, failing when
+// a panel refers to a metric that is not exported
+func BuildDashboard(opts DashboardOptions) (Dashboard, error) {
+	b := &dashboardBuilder{variables: []variable{
+		{name: "account", label: opts.AccountLabel},
+		{name: "region", label: opts.RegionLabel},
+		{name: "vpc", label: "vpcid"},
+		{name: "name", label: "name"},
+	}}
+
+	b.row("Subnets")
+	b.add(24, 10, panel{
+		Type:  "table",
+		Title: "Subnet utilization",
+		Targets: []target{
+			b.tableTarget("A", "utilization_ratio"),
+			b.tableTarget("B", "available_ips"),
+			b.tableTarget("C", "free_ips"),
+			b.tableTarget("D", "max_ips"),
+			b.tableTarget("E", "available_prefixes"),
+			b.tableTarget("F", "pod_capacity"),
+		},
+		Transformations: []transformation{
+			{ID: "merge", Options: map[string]interface{}{}},
+			{ID: "organize", Options: map[string]interface{}{
+				"excludeByName": map[string]bool{"Time": true, "__name__": true},
+				"renameByName": map[string]string{
+					"Value #A": "Utilization",
+					"Value #B": "Available IPs (AWS)",
+					"Value #C": "Free IPs (computed)",
+					"Value #D": "Max IPs",
+					"Value #E": "Available prefixes",
+					"Value #F": "Pod capacity",
+				},
+			}},
+		},
+	})
+	b.add(12, 8, b.timeseries("Utilization ratio", "{{name}} ({{subnetid}})", "utilization_ratio"))
+	b.add(12, 8, b.timeseries("Available IPs", "{{name}} ({{subnetid}})", "available_ips"))
+
+	b.row("Availability zones")
+	b.add(8, 8, b.timeseries("Free IPs per availability zone", "{{vpcid}} {{az}}", "az_free_ips"))
+	b.add(8, 8, b.timeseries("Available prefixes per availability zone", "{{vpcid}} {{az}}", "az_available_prefixes"))
+	b.add(8, 8, b.timeseries("Pod capacity per availability zone", "{{vpcid}} {{az}}", "az_pod_capacity"))
+	b.add(12, 8, b.timeseries("Free IP skew between availability zones", "{{vpcid}}", "vpc_az_free_ips_skew"))
+	b.add(12, 8, b.timeseries("Free prefix skew between availability zones", "{{vpcid}}", "vpc_az_free_prefixes_skew"))
+
+	b.row("Prefixes")
+	b.add(8, 8, b.timeseries("Available prefixes", "{{name}} ({{subnetid}})", "available_prefixes"))
+	b.add(8, 8, b.timeseries("Used prefixes", "{{name}} ({{subnetid}})", "used_prefixes"))
+	b.add(8, 8, b.timeseries("Max prefixes", "{{name}} ({{subnetid}})", "max_prefixes"))
+	b.add(12, 8, b.timeseries("Available prefixes in prefix reservations", "{{name}} ({{subnetid}})", "reserved_available_prefixes"))
+	b.add(12, 8, b.timeseries("Available prefixes outside reservations", "{{name}} ({{subnetid}})", "unreserved_available_prefixes"))
+
+	b.row("Exporter")
+	b.add(8, 6, b.stat("Time since last refresh", "s", "time() - %s", "last_refresh_timestamp_seconds"))
+	b.add(8, 6, b.stat("Refresh duration", "s", "%s", "refresh_duration_seconds"))
+	b.add(8, 6, b.stat("Subnets exported", "none", "count(%s)", "available_ips"))
+
+	if b.err != nil {
+		return Dashboard{}, b.err
+	}
+
+	dashboard := Dashboard{
+		UID:           opts.UID,
+		Title:         opts.Title,
+		Tags:          []string{"aws", "subnets"},
+		Timezone:      "browser",
+		SchemaVersion: 36,
+		Refresh:       "1m",
+		Time:          timeRange{From: "now-6h", To: "now"},
+		Panels:        b.panels,
+		Annotations:   annotations{List: []interface{}{}},
+	}
+	dashboard.Templating.List = append(dashboard.Templating.List, templateVariable{
+		Name:  datasourceVariable,
+		Label: "Data source",
+		Type:  "datasource",
+		Query: "prometheus",
+	})
+	for _, v := range b.variables {
+		dashboard.Templating.List = append(dashboard.Templating.List, templateVariable{
+			Name:       v.name,
+			Type:       "query",
+			Datasource: dashboardDatasource(),
+			Query: map[string]string{
+				"query": fmt.Sprintf("label_values(%s, %s)", b.metric("available_ips"), v.label),
+				"refId": "PrometheusVariableQueryEditor-VariableQuery",
+			},
+			Refresh:    2,
+			IncludeAll: true,
+			// matches series without the label as well, e.g. when no account label is set
+			AllValue: ".*",
+			Multi:    true,
+			Sort:     1,
+		})
+	}
+	return dashboard, nil
+}
+
+// Render the dashboard as indented JSON
+func DashboardJSON(d Dashboard) ([]byte, error) {
+	out, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot render dashboard")
+	}
+	return append(out, '\n'), nil
+}
+
+func dashboardDatasource() *datasource {
+	return &datasource{Type: "prometheus", UID: "${" + datasourceVariable + "}"}
+}
+
+// Namespaced name of the metric, recording an error when it is not exported
+func (b *dashboardBuilder) metric(name string) string {
+	d, ok := prom.Lookup(name)
+	if !ok {
+		if b.err == nil {
+			b.err = fmt.Errorf("dashboard refers to metric %s that is not exported", name)
+		}
+		return name
+	}
+	return d.FQName
+}
+
+// Metric with matchers for the template variables whose labels it has. Account and
+// region usually come from constant labels, which are not part of the definitions,
+// so they are always matched.
+func (b *dashboardBuilder) selector(name string) string {
+	d, _ := prom.Lookup(name)
+	var matchers []string
+	for _, v := range b.variables {
+		if v.name == "account" || v.name == "region" || contains(d.Labels, v.label) {
+			matchers = append(matchers, fmt.Sprintf("%s=~\"$%s\"", v.label, v.name))
+		}
+	}
+	return b.metric(name) + "{" + strings.Join(matchers, ", ") + "}"
+}
+
+func (b *dashboardBuilder) tableTarget(refID, metric string) target {
+	return target{RefID: refID, Expr: b.selector(metric), Format: "table", Instant: true}
+}
+
+func (b *dashboardBuilder) timeseries(title, legend, metric string) panel {
+	d, _ := prom.Lookup(metric)
+	return panel{
+		Type:        "timeseries",
+		Title:       title,
+		Description: d.Help,
+		Targets:     []target{{RefID: "A", Expr: b.selector(metric), LegendFormat: legend}},
+	}
+}
+
+// Stat panel of an expression, %s is replaced by the metric with its matchers
+func (b *dashboardBuilder) stat(title, unit, expr, metric string) panel {
+	d, _ := prom.Lookup(metric)
+	return panel{
+		Type:        "stat",
+		Title:       title,
+		Description: d.Help,
+		Targets:     []target{{RefID: "A", Expr: fmt.Sprintf(expr, b.selector(metric))}},
+		FieldConfig: map[string]interface{}{
+			"defaults":  map[string]interface{}{"unit": unit},
+			"overrides": []interface{}{},
+		},
+	}
+}
+
+// Start a new row of panels
+func (b *dashboardBuilder) row(title string) {
+	if b.x > 0 {
+		b.y += b.h
+	}
+	b.nextID++
+	b.panels = append(b.panels, panel{
+		ID:      b.nextID,
+		Type:    "row",
+		Title:   title,
+		GridPos: gridPos{H: 1, W: dashboardWidth, X: 0, Y: b.y},
+		Panels:  []panel{},
+	})
+	b.x, b.y, b.h = 0, b.y+1, 0
+}
+
+// Place the panel right of the previous one, wrapping to the next line when the row is full
+func (b *dashboardBuilder) add(w, h int, p panel) {
+	if b.x+w > dashboardWidth {
+		b.x, b.y, b.h = 0, b.y+b.h, 0
+	}
+	b.nextID++
+	p.ID = b.nextID
+	p.GridPos = gridPos{H: h, W: w, X: b.x, Y: b.y}
+	p.Datasource = dashboardDatasource()
+	b.panels = append(b.panels, p)
+	b.x += w
+	if h > b.h {
+		b.h = h
+	}
+}
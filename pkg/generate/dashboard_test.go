@@ -0,0 +1,62 @@
+package generate
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	prom "github.com/ministryofjustice/aws-subnet-exporter/pkg/prometheus"
+)
+
+func TestBuildDashboard(t *testing.T) {
+	if err := prom.RegisterMetrics(prom.Options{Namespace: "subnets"}); err != nil {
+		t.Fatal(err)
+	}
+
+	dashboard, err := BuildDashboard(DashboardOptions{Title: "Subnets", AccountLabel: "account", RegionLabel: "region"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var variables []string
+	for _, v := range dashboard.Templating.List {
+		variables = append(variables, v.Name)
+	}
+	if got := strings.Join(variables, ","); got != "datasource,account,region,vpc,name" {
+		t.Errorf("template variables = %s", got)
+	}
+
+	ids := map[int]bool{}
+	exprs := map[string]string{}
+	for _, p := range dashboard.Panels {
+		if ids[p.ID] {
+			t.Errorf("duplicate panel ID %d", p.ID)
+		}
+		ids[p.ID] = true
+		if p.GridPos.X+p.GridPos.W > dashboardWidth {
+			t.Errorf("panel %s overflows the dashboard width", p.Title)
+		}
+		for _, target := range p.Targets {
+			exprs[p.Title] = target.Expr
+		}
+	}
+	want := map[string]string{
+		"Available IPs":                  `subnets_available_ips{account=~"$account", region=~"$region", vpcid=~"$vpc", name=~"$name"}`,
+		"Free IPs per availability zone": `subnets_az_free_ips{account=~"$account", region=~"$region", vpcid=~"$vpc"}`,
+		"Time since last refresh":        `time() - subnets_last_refresh_timestamp_seconds{account=~"$account", region=~"$region"}`,
+	}
+	for title, expr := range want {
+		if exprs[title] != expr {
+			t.Errorf("panel %s expr = %s, want %s", title, exprs[title], expr)
+		}
+	}
+
+	out, err := DashboardJSON(dashboard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(out, &decoded); err != nil {
+		t.Fatalf("invalid dashboard JSON: %v", err)
+	}
+}
@@ -0,0 +1,264 @@
+package generate
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	prom "github.com/ministryofjustice/aws-subnet-exporter/pkg/prometheus"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"sigs.k8s.io/yaml"
+)
+
+// Output formats of the alerting rules
+const (
+	FormatPrometheusRule = "prometheusrule"
+	FormatRules          = "rules"
+
+	groupName = "aws-subnet-exporter"
+)
+
+// Thresholds and labels of the generated alerting rules, a zero threshold leaves its rule out
+type RuleOptions struct {
+	MinFreeIPs           int
+	MaxUtilization       float64
+	MinAvailablePrefixes int
+	// Alert when a subnet is predicted to run out within this window
+	ExhaustionWindow time.Duration
+	// Alert when less than this share of the VPC address space is left for new subnets
+	MinVPCUnallocatedRatio float64
+	// Time a condition has to hold before the alert fires
+	For time.Duration
+	// Labels added to every alert, e.g. severity or team
+	Labels map[string]string
+}
+
+// Alerting rule in the Prometheus rule file format
+type Rule struct {
+	Alert       string            `json:"alert"`
+	Expr        string            `json:"expr"`
+	For         string            `json:"for,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type RuleGroup struct {
+	Name  string `json:"name"`
+	Rules []Rule `json:"rules"`
+}
+
+type ruleFile struct {
+	Groups []RuleGroup `json:"groups"`
+}
+
+type prometheusRule struct {
+	APIVersion string     `json:"apiVersion"`
+	Kind       string     `json:"kind"`
+	Metadata   objectMeta `json:"metadata"`
+	Spec       ruleFile   `json:"spec"`
+}
+
+type objectMeta struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Alerting rule before metric names are resolved, %s in the expression are replaced
+// by the namespaced names of the metrics in order
+type ruleTemplate struct {
+	alert       string
+	expr        string
+	metrics     []string
+	enabled     bool
+	severity    string
+	summary     string
+	description string
+}
+
+// Annotation naming the subnet of an alert
+const subnetDescription = "{{ $labels.name }} ({{ $labels.subnetid }}) in {{ $labels.az }} of {{ $labels.vpcid }}"
+
+// Build the alerting rules for the metrics registered in pkg/prometheus, failing when
+// a rule refers to a metric or label that is not exported
+func Rules(opts RuleOptions) (RuleGroup, error) {
+	templates := []ruleTemplate{
+		{
+			alert:       "SubnetLowFreeIPs",
+			expr:        fmt.Sprintf("%%s < %d", opts.MinFreeIPs),
+			metrics:     []string{"available_ips"},
+			enabled:     opts.MinFreeIPs > 0,
+			severity:    "warning",
+			summary:     "Subnet is running out of IPs",
+			description: "Subnet " + subnetDescription + " has {{ $value }} IPs available.",
+		},
+		{
+			alert:       "SubnetHighUtilization",
+			expr:        fmt.Sprintf("%%s > %g", opts.MaxUtilization),
+			metrics:     []string{"utilization_ratio"},
+			enabled:     opts.MaxUtilization > 0,
+			severity:    "warning",
+			summary:     "Subnet is highly utilized",
+			description: "Subnet " + subnetDescription + " is {{ $value | humanizePercentage }} utilized.",
+		},
+		{
+			alert:       "SubnetLowAvailablePrefixes",
+			expr:        fmt.Sprintf("%%s < %d", opts.MinAvailablePrefixes),
+			metrics:     []string{"available_prefixes"},
+			enabled:     opts.MinAvailablePrefixes > 0,
+			severity:    "warning",
+			summary:     "Subnet is running out of /28 prefixes",
+			description: "Subnet " + subnetDescription + " has {{ $value }} /28 prefixes available for prefix delegation.",
+		},
+		{
+			alert:       "SubnetBelowTaggedMinFreeIPs",
+			expr:        "%s < %s",
+			metrics:     []string{"free_ips", "min_free_ips_threshold"},
+			enabled:     true,
+			severity:    "warning",
+			summary:     "Subnet has fewer free IPs than its aws-subnet-exporter/min-free-ips tag",
+			description: "Subnet " + subnetDescription + " has {{ $value }} free IPs, below the threshold in its tags.",
+		},
+		{
+			alert:       "SubnetBelowTaggedMinFreePrefixes",
+			expr:        "%s < %s",
+			metrics:     []string{"available_prefixes", "min_free_prefixes_threshold"},
+			enabled:     true,
+			severity:    "warning",
+			summary:     "Subnet has fewer available prefixes than its aws-subnet-exporter/min-free-prefixes tag",
+			description: "Subnet " + subnetDescription + " has {{ $value }} available prefixes, below the threshold in its tags.",
+		},
+		{
+			alert:       "SubnetServiceRequirementNotMet",
+			expr:        "%s == 0",
+			metrics:     []string{"requirement_satisfied"},
+			enabled:     true,
+			severity:    "warning",
+			summary:     "Subnet lacks the free IPs an AWS service needs",
+			description: "Subnet " + subnetDescription + " does not have the free IPs the {{ $labels.requirement }} requirement asks for.",
+		},
+		{
+			alert:       "SubnetPolicyViolation",
+			expr:        "%s == 1",
+			metrics:     []string{"policy_violation"},
+			enabled:     true,
+			severity:    "warning",
+			summary:     "Subnet violates a policy rule",
+			description: "Subnet " + subnetDescription + " violates policy rule {{ $labels.rule }}.",
+		},
+		{
+			alert:       "SubnetExhaustionPredicted",
+			expr:        fmt.Sprintf("%%s < %d", int64(opts.ExhaustionWindow.Seconds())),
+			metrics:     []string{"predicted_exhaustion_seconds"},
+			enabled:     opts.ExhaustionWindow > 0,
+			severity:    "warning",
+			summary:     "Subnet is predicted to run out of capacity",
+			description: "Subnet " + subnetDescription + " is predicted to run out of {{ $labels.resource }} in {{ $value | humanizeDuration }}.",
+		},
+		{
+			alert:       "VPCAddressSpaceLow",
+			expr:        fmt.Sprintf("%%s / %%s < %g", opts.MinVPCUnallocatedRatio),
+			metrics:     []string{"vpc_unallocated_ips", "vpc_cidr_ips"},
+			enabled:     opts.MinVPCUnallocatedRatio > 0,
+			severity:    "info",
+			summary:     "VPC has little address space left for new subnets",
+			description: "VPC {{ $labels.vpcid }} has {{ $value | humanizePercentage }} of its CIDR blocks left for new subnets.",
+		},
+	}
+
+	group := RuleGroup{Name: groupName}
+	for _, t := range templates {
+		if !t.enabled {
+			continue
+		}
+		rule, err := t.build(opts)
+		if err != nil {
+			return RuleGroup{}, err
+		}
+		group.Rules = append(group.Rules, rule)
+	}
+	return group, nil
+}
+
+func (t ruleTemplate) build(opts RuleOptions) (Rule, error) {
+	names := make([]interface{}, 0, len(t.metrics))
+	var labels []string
+	for _, m := range t.metrics {
+		d, ok := prom.Lookup(m)
+		if !ok {
+			return Rule{}, fmt.Errorf("alert %s refers to metric %s that is not exported", t.alert, m)
+		}
+		names = append(names, d.FQName)
+		labels = append(labels, d.Labels...)
+	}
+	for _, l := range templateLabels(t.description) {
+		if !contains(labels, l) {
+			return Rule{}, fmt.Errorf("alert %s refers to label %s that is not exported", t.alert, l)
+		}
+	}
+
+	rule := Rule{
+		Alert:  t.alert,
+		Expr:   fmt.Sprintf(t.expr, names...),
+		Labels: map[string]string{"severity": t.severity},
+		Annotations: map[string]string{
+			"summary":     t.summary,
+			"description": t.description,
+		},
+	}
+	if opts.For > 0 {
+		rule.For = model.Duration(opts.For).String()
+	}
+	for k, v := range opts.Labels {
+		rule.Labels[k] = v
+	}
+	return rule, nil
+}
+
+// Labels used as {{ $labels.<name> }} in an annotation
+func templateLabels(text string) []string {
+	var labels []string
+	for _, part := range strings.Split(text, "$labels.")[1:] {
+		end := strings.IndexFunc(part, func(r rune) bool {
+			return !(r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9'))
+		})
+		if end < 0 {
+			end = len(part)
+		}
+		labels = append(labels, part[:end])
+	}
+	return labels
+}
+
+func contains(items []string, item string) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
+
+// Render the rule group as a PrometheusRule resource of the Prometheus operator or as
+// a plain Prometheus rule file
+func RulesYAML(group RuleGroup, format, name string, labels map[string]string) ([]byte, error) {
+	var doc interface{}
+	switch format {
+	case FormatPrometheusRule:
+		doc = prometheusRule{
+			APIVersion: "monitoring.coreos.com/v1",
+			Kind:       "PrometheusRule",
+			Metadata:   objectMeta{Name: name, Labels: labels},
+			Spec:       ruleFile{Groups: []RuleGroup{group}},
+		}
+	case FormatRules:
+		doc = ruleFile{Groups: []RuleGroup{group}}
+	default:
+		return nil, fmt.Errorf("invalid format %q, must be %s or %s", format, FormatPrometheusRule, FormatRules)
+	}
+	out, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot render rules")
+	}
+	return out, nil
+}
@@ -0,0 +1,95 @@
+package generate
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	prom "github.com/ministryofjustice/aws-subnet-exporter/pkg/prometheus"
+	"sigs.k8s.io/yaml"
+)
+
+func TestRules(t *testing.T) {
+	if err := prom.RegisterMetrics(prom.Options{Namespace: "subnets"}); err != nil {
+		t.Fatal(err)
+	}
+
+	group, err := Rules(RuleOptions{
+		MinFreeIPs:       50,
+		MaxUtilization:   0.9,
+		ExhaustionWindow: 24 * time.Hour,
+		For:              15 * time.Minute,
+		Labels:           map[string]string{"team": "platform"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rules := map[string]Rule{}
+	for _, r := range group.Rules {
+		rules[r.Alert] = r
+	}
+	if _, ok := rules["SubnetLowAvailablePrefixes"]; ok {
+		t.Error("rule with a zero threshold was generated")
+	}
+	want := map[string]string{
+		"SubnetLowFreeIPs":            "subnets_available_ips < 50",
+		"SubnetHighUtilization":       "subnets_utilization_ratio > 0.9",
+		"SubnetBelowTaggedMinFreeIPs": "subnets_free_ips < subnets_min_free_ips_threshold",
+		"SubnetExhaustionPredicted":   "subnets_predicted_exhaustion_seconds < 86400",
+	}
+	for alert, expr := range want {
+		r, ok := rules[alert]
+		if !ok {
+			t.Errorf("rule %s was not generated", alert)
+			continue
+		}
+		if r.Expr != expr {
+			t.Errorf("rule %s expr = %q, want %q", alert, r.Expr, expr)
+		}
+		if r.For != "15m" || r.Labels["team"] != "platform" || r.Labels["severity"] == "" {
+			t.Errorf("rule %s has for %q and labels %v", alert, r.For, r.Labels)
+		}
+	}
+}
+
+func TestRulesYAML(t *testing.T) {
+	if err := prom.RegisterMetrics(prom.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	group, err := Rules(RuleOptions{MinFreeIPs: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := RulesYAML(group, FormatPrometheusRule, "subnet-alerts", map[string]string{"release": "prometheus"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resource prometheusRule
+	if err := yaml.UnmarshalStrict(out, &resource); err != nil {
+		t.Fatalf("invalid PrometheusRule %s: %v", out, err)
+	}
+	if resource.Kind != "PrometheusRule" || resource.Metadata.Name != "subnet-alerts" || len(resource.Spec.Groups) != 1 {
+		t.Errorf("unexpected PrometheusRule %s", out)
+	}
+
+	out, err = RulesYAML(group, FormatRules, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(out), "groups:") {
+		t.Errorf("rule file does not start with groups: %s", out)
+	}
+
+	if _, err := RulesYAML(group, "json", "", nil); err == nil {
+		t.Error("RulesYAML() accepted an unknown format")
+	}
+}
+
+func TestTemplateLabels(t *testing.T) {
+	got := templateLabels("{{ $labels.name }} in {{ $labels.az }}")
+	if strings.Join(got, ",") != "name,az" {
+		t.Errorf("templateLabels() = %v, want [name az]", got)
+	}
+}
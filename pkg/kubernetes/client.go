@@ -0,0 +1,46 @@
+package kubernetes
+
+import (
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	errCannotLoadConfig = "unable to load Kubernetes config"
+)
+
+// Clients for the Kubernetes API, the dynamic client reads custom resources such as ENIConfig
+type Clients struct {
+	Clientset kubernetes.Interface
+	Dynamic   dynamic.Interface
+}
+
+// Initialize Kubernetes clients from a kubeconfig, or from the in-cluster config when kubeconfig is empty
+func InitClients(kubeconfig string) (*Clients, error) {
+	log.Debug("Initializing Kubernetes clients")
+	var cfg *rest.Config
+	var err error
+	if kubeconfig == "" {
+		cfg, err = rest.InClusterConfig()
+	} else {
+		cfg, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+	}
+	if err != nil {
+		log.Error("Failed to load Kubernetes config")
+		return nil, errors.Wrap(err, errCannotLoadConfig)
+	}
+
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, errCannotLoadConfig)
+	}
+	dynamicClient, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, errCannotLoadConfig)
+	}
+	return &Clients{Clientset: clientset, Dynamic: dynamicClient}, nil
+}
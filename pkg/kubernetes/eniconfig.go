@@ -0,0 +1,88 @@
+package kubernetes
+
+import (
+	"context"
+
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/aws"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// Custom resource the VPC CNI reads custom networking settings from
+var ENIConfigResource = schema.GroupVersionResource{
+	Group:    "crd.k8s.amazonaws.com",
+	Version:  "v1alpha1",
+	Resource: "eniconfigs",
+}
+
+// ENIConfig pointing pods at a subnet other than the subnet of their node
+type ENIConfig struct {
+	Name           string
+	Subnet         string
+	SecurityGroups []string
+}
+
+// List the ENIConfig resources in the cluster
+func GetENIConfigs(ctx context.Context, client dynamic.Interface) ([]ENIConfig, error) {
+	log.Debug("Listing ENIConfigs")
+	list, err := client.Resource(ENIConfigResource).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot list ENIConfigs")
+	}
+
+	configs := make([]ENIConfig, 0, len(list.Items))
+	for _, item := range list.Items {
+		subnet, _, err := unstructured.NestedString(item.Object, "spec", "subnet")
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid ENIConfig %s", item.GetName())
+		}
+		securityGroups, _, err := unstructured.NestedStringSlice(item.Object, "spec", "securityGroups")
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid ENIConfig %s", item.GetName())
+		}
+		configs = append(configs, ENIConfig{
+			Name:           item.GetName(),
+			Subnet:         subnet,
+			SecurityGroups: securityGroups,
+		})
+	}
+	return configs, nil
+}
+
+// Record on every subnet the names of the ENIConfigs that place pods in it
+func ApplyENIConfigs(subnets []aws.Subnet, configs []ENIConfig) {
+	for i := range subnets {
+		subnets[i].ENIConfigs = nil
+		for _, c := range configs {
+			if c.Subnet == subnets[i].SubnetID {
+				subnets[i].ENIConfigs = append(subnets[i].ENIConfigs, c.Name)
+			}
+		}
+	}
+}
+
+// Labels subnets with the ENIConfigs on every refresh. The ENIConfigs of the last
+// successful listing are kept, so a failed listing does not drop the labels of a refresh.
+type ENIConfigLabeler struct {
+	client  dynamic.Interface
+	configs []ENIConfig
+}
+
+func NewENIConfigLabeler(client dynamic.Interface) *ENIConfigLabeler {
+	return &ENIConfigLabeler{client: client}
+}
+
+// List the ENIConfigs and record them on the subnets, falling back to the ENIConfigs of
+// the last successful listing when listing fails
+func (l *ENIConfigLabeler) Label(ctx context.Context, subnets []aws.Subnet) error {
+	configs, err := GetENIConfigs(ctx, l.client)
+	if err == nil {
+		l.configs = configs
+	}
+	ApplyENIConfigs(subnets, l.configs)
+	return err
+}
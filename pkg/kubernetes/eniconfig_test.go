@@ -0,0 +1,84 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/aws"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newENIConfig(name, subnet string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "crd.k8s.amazonaws.com/v1alpha1",
+		"kind":       "ENIConfig",
+		"metadata":   map[string]interface{}{"name": name},
+		"spec": map[string]interface{}{
+			"subnet":         subnet,
+			"securityGroups": []interface{}{"sg-1"},
+		},
+	}}
+}
+
+func TestGetENIConfigs(t *testing.T) {
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{ENIConfigResource: "ENIConfigList"},
+		newENIConfig("eu-west-2a", "subnet-1"),
+		newENIConfig("eu-west-2b", "subnet-2"),
+	)
+
+	configs, err := GetENIConfigs(context.Background(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(configs) != 2 {
+		t.Fatalf("GetENIConfigs() returned %d configs, want 2", len(configs))
+	}
+
+	subnets := []aws.Subnet{{SubnetID: "subnet-1"}, {SubnetID: "subnet-2"}, {SubnetID: "subnet-3"}}
+	ApplyENIConfigs(subnets, configs)
+
+	want := map[string]string{"subnet-1": "eu-west-2a", "subnet-2": "eu-west-2b"}
+	for _, s := range subnets {
+		if want[s.SubnetID] == "" {
+			if len(s.ENIConfigs) != 0 {
+				t.Errorf("subnet %s has ENIConfigs %v, want none", s.SubnetID, s.ENIConfigs)
+			}
+			continue
+		}
+		if len(s.ENIConfigs) != 1 || s.ENIConfigs[0] != want[s.SubnetID] {
+			t.Errorf("subnet %s has ENIConfigs %v, want [%s]", s.SubnetID, s.ENIConfigs, want[s.SubnetID])
+		}
+	}
+}
+
+func TestENIConfigLabeler(t *testing.T) {
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{ENIConfigResource: "ENIConfigList"},
+		newENIConfig("eu-west-2a", "subnet-1"),
+	)
+	labeler := NewENIConfigLabeler(client)
+
+	subnets := []aws.Subnet{{SubnetID: "subnet-1"}}
+	if err := labeler.Label(context.Background(), subnets); err != nil {
+		t.Fatal(err)
+	}
+
+	client.PrependReactor("list", "eniconfigs", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("connection refused")
+	})
+	subnets = []aws.Subnet{{SubnetID: "subnet-1"}}
+	if err := labeler.Label(context.Background(), subnets); err == nil {
+		t.Error("Label() returned no error for a failed listing")
+	}
+	if len(subnets[0].ENIConfigs) != 1 || subnets[0].ENIConfigs[0] != "eu-west-2a" {
+		t.Errorf("subnet-1 has ENIConfigs %v after a failed listing, want [eu-west-2a]", subnets[0].ENIConfigs)
+	}
+}
@@ -0,0 +1,161 @@
+package kubernetes
+
+import (
+	"context"
+	"net/netip"
+	"sort"
+	"strings"
+
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/aws"
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// Page size when listing pods and nodes
+	listLimit = 500
+)
+
+// IPs of the running pods in the cluster and the instances behind its nodes
+type PodIPs struct {
+	// Node names keyed by EC2 instance ID
+	Nodes map[string]string
+	// IPs of pods not using the host network
+	IPs map[netip.Addr]bool
+}
+
+// List the nodes and the IPs of the pods in the cluster
+func GetPodIPs(ctx context.Context, client kubernetes.Interface) (PodIPs, error) {
+	podIPs := PodIPs{Nodes: map[string]string{}, IPs: map[netip.Addr]bool{}}
+
+	log.Debug("Listing nodes")
+	opts := metav1.ListOptions{Limit: listLimit}
+	for {
+		nodes, err := client.CoreV1().Nodes().List(ctx, opts)
+		if err != nil {
+			return PodIPs{}, errors.Wrap(err, "cannot list nodes")
+		}
+		for _, node := range nodes.Items {
+			if id := instanceID(node.Spec.ProviderID); id != "" {
+				podIPs.Nodes[id] = node.Name
+			}
+		}
+		if opts.Continue = nodes.Continue; opts.Continue == "" {
+			break
+		}
+	}
+
+	log.Debug("Listing pods")
+	opts = metav1.ListOptions{Limit: listLimit}
+	for {
+		pods, err := client.CoreV1().Pods(metav1.NamespaceAll).List(ctx, opts)
+		if err != nil {
+			return PodIPs{}, errors.Wrap(err, "cannot list pods")
+		}
+		for _, pod := range pods.Items {
+			// pods on the host network use the IP of their node, finished pods gave theirs back
+			if pod.Spec.HostNetwork || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+				continue
+			}
+			for _, ip := range pod.Status.PodIPs {
+				if addr, err := netip.ParseAddr(ip.IP); err == nil {
+					podIPs.IPs[addr] = true
+				}
+			}
+		}
+		if opts.Continue = pods.Continue; opts.Continue == "" {
+			break
+		}
+	}
+	return podIPs, nil
+}
+
+// Records pod IP usage on subnets, keeping the pod IPs of the last successful listing
+type PodIPLabeler struct {
+	client kubernetes.Interface
+	podIPs *PodIPs
+}
+
+func NewPodIPLabeler(client kubernetes.Interface) *PodIPLabeler {
+	return &PodIPLabeler{client: client}
+}
+
+// List the nodes and pods and record their IP usage on the subnets, falling back to the
+// pod IPs of the last successful listing when listing fails
+func (l *PodIPLabeler) Label(ctx context.Context, subnets []aws.Subnet) error {
+	podIPs, err := GetPodIPs(ctx, l.client)
+	if err == nil {
+		l.podIPs = &podIPs
+	}
+	if l.podIPs != nil {
+		ApplyPodIPs(subnets, *l.podIPs)
+	}
+	return err
+}
+
+// EC2 instance ID from a provider ID such as aws:///eu-west-2a/i-0123456789abcdef0
+func instanceID(providerID string) string {
+	if !strings.HasPrefix(providerID, "aws://") {
+		return ""
+	}
+	return providerID[strings.LastIndex(providerID, "/")+1:]
+}
+
+// Record on every subnet the IPs assigned to the network interfaces of each node
+// in the cluster and how many of them pods use
+func ApplyPodIPs(subnets []aws.Subnet, podIPs PodIPs) {
+	for i := range subnets {
+		subnets[i].NodeIPs = nodeIPUsage(subnets[i].Interfaces, podIPs)
+	}
+}
+
+func nodeIPUsage(interfaces []aws.NetworkInterface, podIPs PodIPs) []aws.NodeIPUsage {
+	usage := map[string]*aws.NodeIPUsage{}
+	for _, iface := range interfaces {
+		node, ok := podIPs.Nodes[iface.InstanceID]
+		if !ok {
+			continue
+		}
+		if _, ok := usage[node]; !ok {
+			usage[node] = &aws.NodeIPUsage{Node: node, InstanceID: iface.InstanceID}
+		}
+		u := usage[node]
+
+		// the primary IP of an interface belongs to the node, pods get the secondary IPs and prefixes
+		for _, ip := range iface.PrivateIPs {
+			if ip.Primary {
+				continue
+			}
+			u.AssignedIPs++
+			if addr, err := netip.ParseAddr(ip.Address); err == nil && podIPs.IPs[addr] {
+				u.PodIPs++
+			}
+		}
+		prefixes, err := utils.ParsePrefixes(iface.Prefixes)
+		if err != nil {
+			log.WithError(err).Warnf("Skipping prefixes of network interface %s", iface.InterfaceID)
+			continue
+		}
+		for _, prefix := range prefixes {
+			u.AssignedIPs += utils.PrefixSize(prefix)
+			for addr := prefix.Addr(); prefix.Contains(addr); addr = addr.Next() {
+				if podIPs.IPs[addr] {
+					u.PodIPs++
+				}
+			}
+		}
+	}
+
+	nodes := make([]aws.NodeIPUsage, 0, len(usage))
+	for _, u := range usage {
+		nodes = append(nodes, *u)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Node < nodes[j].Node
+	})
+	return nodes
+}
@@ -0,0 +1,146 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/aws"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newNode(name, providerID string) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       corev1.NodeSpec{ProviderID: providerID},
+	}
+}
+
+func newPod(name, ip string, hostNetwork bool, phase corev1.PodPhase) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec:       corev1.PodSpec{HostNetwork: hostNetwork},
+		Status: corev1.PodStatus{
+			Phase:  phase,
+			PodIP:  ip,
+			PodIPs: []corev1.PodIP{{IP: ip}},
+		},
+	}
+}
+
+func TestApplyPodIPs(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		newNode("node-a", "aws:///eu-west-2a/i-a"),
+		newNode("node-b", "aws:///eu-west-2a/i-b"),
+		newPod("secondary", "10.0.0.11", false, corev1.PodRunning),
+		newPod("prefix-1", "10.0.0.33", false, corev1.PodRunning),
+		newPod("prefix-2", "10.0.0.34", false, corev1.PodPending),
+		newPod("host", "10.0.0.10", true, corev1.PodRunning),
+		newPod("done", "10.0.0.12", false, corev1.PodSucceeded),
+	)
+
+	podIPs, err := GetPodIPs(context.Background(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(podIPs.Nodes) != 2 || len(podIPs.IPs) != 3 {
+		t.Fatalf("GetPodIPs() found %d nodes and %d pod IPs, want 2 and 3", len(podIPs.Nodes), len(podIPs.IPs))
+	}
+
+	subnets := []aws.Subnet{{
+		SubnetID: "subnet-1",
+		Interfaces: []aws.NetworkInterface{
+			{
+				// secondary IP mode node, one of its two secondary IPs used
+				InterfaceID: "eni-a",
+				InstanceID:  "i-a",
+				PrivateIPs: []aws.PrivateIP{
+					{Address: "10.0.0.10", Primary: true},
+					{Address: "10.0.0.11"},
+					{Address: "10.0.0.12"},
+				},
+			},
+			{
+				// prefix mode node, two of the 16 prefix IPs used
+				InterfaceID: "eni-b",
+				InstanceID:  "i-b",
+				PrivateIPs:  []aws.PrivateIP{{Address: "10.0.0.20", Primary: true}},
+				Prefixes:    []string{"10.0.0.32/28"},
+			},
+			{
+				// instance outside the cluster
+				InterfaceID: "eni-c",
+				InstanceID:  "i-c",
+				PrivateIPs:  []aws.PrivateIP{{Address: "10.0.0.21", Primary: true}, {Address: "10.0.0.22"}},
+			},
+		},
+	}}
+	ApplyPodIPs(subnets, podIPs)
+
+	want := []aws.NodeIPUsage{
+		{Node: "node-a", InstanceID: "i-a", AssignedIPs: 2, PodIPs: 1},
+		{Node: "node-b", InstanceID: "i-b", AssignedIPs: 16, PodIPs: 2},
+	}
+	got := subnets[0].NodeIPs
+	if len(got) != len(want) {
+		t.Fatalf("NodeIPs = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("NodeIPs[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if subnets[0].PodIPs() != 3 || subnets[0].IdleIPs() != 15 {
+		t.Errorf("PodIPs() = %d, IdleIPs() = %d, want 3 and 15", subnets[0].PodIPs(), subnets[0].IdleIPs())
+	}
+}
+
+func TestPodIPLabeler(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		newNode("node-a", "aws:///eu-west-2a/i-a"),
+		newPod("secondary", "10.0.0.11", false, corev1.PodRunning),
+	)
+	labeler := NewPodIPLabeler(client)
+	newSubnets := func() []aws.Subnet {
+		return []aws.Subnet{{
+			SubnetID: "subnet-1",
+			Interfaces: []aws.NetworkInterface{{
+				InterfaceID: "eni-a",
+				InstanceID:  "i-a",
+				PrivateIPs:  []aws.PrivateIP{{Address: "10.0.0.10", Primary: true}, {Address: "10.0.0.11"}},
+			}},
+		}}
+	}
+
+	failing := fake.NewSimpleClientset()
+	failing.PrependReactor("list", "nodes", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("connection refused")
+	})
+	subnets := newSubnets()
+	if err := NewPodIPLabeler(failing).Label(context.Background(), subnets); err == nil {
+		t.Error("Label() returned no error for a failed listing")
+	}
+	if subnets[0].NodeIPs != nil {
+		t.Errorf("NodeIPs = %+v without a successful listing, want none", subnets[0].NodeIPs)
+	}
+
+	subnets = newSubnets()
+	if err := labeler.Label(context.Background(), subnets); err != nil {
+		t.Fatal(err)
+	}
+
+	client.PrependReactor("list", "pods", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("connection refused")
+	})
+	subnets = newSubnets()
+	if err := labeler.Label(context.Background(), subnets); err == nil {
+		t.Error("Label() returned no error for a failed listing")
+	}
+	if subnets[0].PodIPs() != 1 {
+		t.Errorf("PodIPs() = %d after a failed listing, want 1", subnets[0].PodIPs())
+	}
+}
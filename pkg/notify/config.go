@@ -0,0 +1,140 @@
+package notify
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"text/template"
+	"time"
+
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/aws"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+// Payload formats webhooks can receive
+const (
+	FormatJSON  = "json"
+	FormatSlack = "slack"
+	FormatTeams = "teams"
+
+	// Time between notifications of an alert that keeps firing when none is configured
+	DefaultResendInterval = 4 * time.Hour
+)
+
+// Layout of the notifier config file
+type Config struct {
+	// Time between notifications of an alert that keeps firing, e.g. 4h
+	ResendInterval string      `json:"resendInterval,omitempty"`
+	Webhooks       []Webhook   `json:"webhooks"`
+	Thresholds     []Threshold `json:"thresholds"`
+}
+
+// Receiver of alert notifications
+type Webhook struct {
+	URL string `json:"url"`
+	// json, slack or teams, ignored when a template is given
+	Format string `json:"format,omitempty"`
+	// Go template rendering the request body from an Alert
+	Template string `json:"template,omitempty"`
+}
+
+// Alert raised for every subnet whose field is below or above a limit
+type Threshold struct {
+	Name  string   `json:"name"`
+	Field string   `json:"field"`
+	Below *float64 `json:"below,omitempty"`
+	Above *float64 `json:"above,omitempty"`
+}
+
+// Subnet fields thresholds can be set on
+var fields = map[string]func(aws.Subnet) float64{
+	"available_ips":      func(s aws.Subnet) float64 { return s.AvailableIPs },
+	"free_ips":           func(s aws.Subnet) float64 { return float64(s.FreeIPs) },
+	"allocated_ips":      func(s aws.Subnet) float64 { return float64(s.AllocatedIPs) },
+	"utilization_ratio":  func(s aws.Subnet) float64 { return s.UtilizationRatio() },
+	"available_prefixes": func(s aws.Subnet) float64 { return float64(len(s.AvailablePrefixes)) },
+	"used_prefixes":      func(s aws.Subnet) float64 { return float64(s.UsedPrefixes) },
+	"pod_capacity":       func(s aws.Subnet) float64 { return float64(s.PodCapacity) },
+}
+
+// Read the notifier config from a YAML or JSON file
+func Load(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, errors.Wrap(err, "cannot read notifier config")
+	}
+	var config Config
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return Config{}, errors.Wrapf(err, "cannot parse notifier config %s", path)
+	}
+	return config, config.Validate()
+}
+
+func (c Config) Validate() error {
+	if _, err := c.resendInterval(); err != nil {
+		return err
+	}
+	if len(c.Webhooks) == 0 {
+		return fmt.Errorf("notifier config has no webhooks")
+	}
+	// webhooks are identified by their position, their URLs may hold tokens
+	for i, w := range c.Webhooks {
+		if u, err := url.Parse(w.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("invalid URL of webhook %d, must be an http or https URL", i)
+		}
+		if w.Template != "" {
+			if _, err := parseTemplate(w.Template); err != nil {
+				return errors.Wrapf(err, "invalid template of webhook %d", i)
+			}
+			continue
+		}
+		switch w.Format {
+		case "", FormatJSON, FormatSlack, FormatTeams:
+		default:
+			return fmt.Errorf("invalid format %q of webhook %d, must be %s, %s or %s", w.Format, i, FormatJSON, FormatSlack, FormatTeams)
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, t := range c.Thresholds {
+		if t.Name == "" {
+			return fmt.Errorf("threshold without a name")
+		}
+		if seen[t.Name] {
+			return fmt.Errorf("duplicate threshold %s", t.Name)
+		}
+		seen[t.Name] = true
+		if _, ok := fields[t.Field]; !ok {
+			return fmt.Errorf("unknown field %q in threshold %s", t.Field, t.Name)
+		}
+		if (t.Below == nil) == (t.Above == nil) {
+			return fmt.Errorf("threshold %s must set exactly one of below and above", t.Name)
+		}
+	}
+	return nil
+}
+
+func (c Config) resendInterval() (time.Duration, error) {
+	if c.ResendInterval == "" {
+		return DefaultResendInterval, nil
+	}
+	d, err := time.ParseDuration(c.ResendInterval)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid resend interval %q", c.ResendInterval)
+	}
+	return d, nil
+}
+
+// Whether the subnet breaches the threshold, along with the value of the field and the limit
+func (t Threshold) check(s aws.Subnet) (bool, float64, float64) {
+	value := fields[t.Field](s)
+	if t.Below != nil {
+		return value < *t.Below, value, *t.Below
+	}
+	return value > *t.Above, value, *t.Above
+}
+
+func parseTemplate(text string) (*template.Template, error) {
+	return template.New("webhook").Funcs(template.FuncMap{"json": jsonString}).Parse(text)
+}
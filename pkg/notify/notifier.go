@@ -0,0 +1,219 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"sort"
+	"text/template"
+	"time"
+
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/aws"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+
+	requestTimeout = 10 * time.Second
+)
+
+// Threshold breached by a subnet
+type Alert struct {
+	Status    string    `json:"status"`
+	Threshold string    `json:"threshold"`
+	Field     string    `json:"field"`
+	Value     float64   `json:"value"`
+	Limit     float64   `json:"limit"`
+	SubnetID  string    `json:"subnetId"`
+	Name      string    `json:"name"`
+	VPCID     string    `json:"vpcId"`
+	AZ        string    `json:"az"`
+	StartsAt  time.Time `json:"startsAt"`
+	// Set on resolved alerts
+	EndsAt *time.Time `json:"endsAt,omitempty"`
+}
+
+// One line summary of the alert
+func (a Alert) Summary() string {
+	return fmt.Sprintf("[%s] %s: %s of subnet %s (%s, %s) is %g, limit %g", a.Status, a.Threshold, a.Field, a.Name, a.SubnetID, a.AZ, a.Value, a.Limit)
+}
+
+type webhook struct {
+	Webhook
+	template *template.Template
+}
+
+type alertState struct {
+	alert Alert
+	// Time each webhook last accepted the alert, by webhook index. Zero when the webhook
+	// has not been sent the alert, or has been sent its resolution.
+	lastSent []time.Time
+}
+
+// Whether any webhook was told about the firing alert and not yet about its resolution
+func (s *alertState) delivered() bool {
+	for _, t := range s.lastSent {
+		if !t.IsZero() {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether the alert has to be posted to the webhook with the given index
+func (s *alertState) due(webhook int, now time.Time, resendInterval time.Duration) bool {
+	lastSent := s.lastSent[webhook]
+	if s.alert.Status == StatusResolved {
+		return !lastSent.IsZero()
+	}
+	return lastSent.IsZero() || now.Sub(lastSent) >= resendInterval
+}
+
+// Notifier checks subnets against thresholds after every refresh and posts firing,
+// repeated and resolved alerts to webhooks
+type Notifier struct {
+	thresholds     []Threshold
+	webhooks       []webhook
+	resendInterval time.Duration
+	client         *http.Client
+	// Alerts firing or resolved but not yet delivered, keyed by threshold and subnet ID
+	active map[[2]string]*alertState
+}
+
+func NewNotifier(config Config) (*Notifier, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	resendInterval, _ := config.resendInterval()
+	n := &Notifier{
+		thresholds:     config.Thresholds,
+		resendInterval: resendInterval,
+		client:         &http.Client{Timeout: requestTimeout},
+		active:         map[[2]string]*alertState{},
+	}
+	for _, w := range config.Webhooks {
+		hook := webhook{Webhook: w}
+		if w.Template != "" {
+			hook.template, _ = parseTemplate(w.Template)
+		}
+		n.webhooks = append(n.webhooks, hook)
+	}
+	return n, nil
+}
+
+// Check the subnets against the thresholds and notify about alerts that started,
+// are due to be sent again or resolved. Delivery is tracked per webhook, so an alert
+// that fails to reach one webhook is retried on the next call without repeating it on
+// the others. Resolved alerts are kept until every webhook that saw them firing took
+// the resolution.
+func (n *Notifier) Notify(ctx context.Context, subnets []aws.Subnet, now time.Time) {
+	firing := map[[2]string]Alert{}
+	for _, s := range subnets {
+		for _, t := range n.thresholds {
+			breached, value, limit := t.check(s)
+			if !breached {
+				continue
+			}
+			firing[[2]string{t.Name, s.SubnetID}] = Alert{
+				Status:    StatusFiring,
+				Threshold: t.Name,
+				Field:     t.Field,
+				Value:     value,
+				Limit:     limit,
+				SubnetID:  s.SubnetID,
+				Name:      s.Name,
+				VPCID:     s.VPCID,
+				AZ:        s.AZ,
+				StartsAt:  now,
+			}
+		}
+	}
+
+	for key, alert := range firing {
+		state, ok := n.active[key]
+		if !ok {
+			state = &alertState{alert: alert, lastSent: make([]time.Time, len(n.webhooks))}
+			n.active[key] = state
+		} else {
+			// an alert firing again before its resolution got out continues where it was
+			alert.StartsAt = state.alert.StartsAt
+			state.alert = alert
+		}
+	}
+	for key, state := range n.active {
+		if _, ok := firing[key]; ok || state.alert.Status == StatusResolved {
+			continue
+		}
+		if !state.delivered() {
+			// never got out, so there is nothing to resolve
+			delete(n.active, key)
+			continue
+		}
+		state.alert.Status = StatusResolved
+		endsAt := now
+		state.alert.EndsAt = &endsAt
+	}
+
+	keys := make([][2]string, 0, len(n.active))
+	for key := range n.active {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return n.active[keys[i]].alert.Summary() < n.active[keys[j]].alert.Summary()
+	})
+	for _, key := range keys {
+		state := n.active[key]
+		for i, w := range n.webhooks {
+			if !state.due(i, now, n.resendInterval) {
+				continue
+			}
+			if err := n.send(ctx, w, state.alert); err != nil {
+				log.WithError(err).Error("Failed to send alert notification")
+				continue
+			}
+			if state.alert.Status == StatusResolved {
+				state.lastSent[i] = time.Time{}
+			} else {
+				state.lastSent[i] = now
+			}
+		}
+		if state.alert.Status == StatusResolved && !state.delivered() {
+			delete(n.active, key)
+		}
+	}
+}
+
+// Post the alert to the webhook in its format
+func (n *Notifier) send(ctx context.Context, w webhook, alert Alert) error {
+	body, err := w.payload(alert)
+	if err != nil {
+		return err
+	}
+	return n.post(ctx, w.URL, body)
+}
+
+func (n *Notifier) post(ctx context.Context, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "cannot create webhook request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		// the URL of a Slack or Teams webhook is a secret, keep it out of the logs
+		if urlErr, ok := err.(*neturl.Error); ok {
+			err = urlErr.Err
+		}
+		return errors.Wrapf(err, "cannot post to webhook on %s", req.URL.Host)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook on %s returned %s", req.URL.Host, resp.Status)
+	}
+	return nil
+}
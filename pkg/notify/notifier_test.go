@@ -0,0 +1,223 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/aws"
+)
+
+// Webhook receiver recording the bodies it was sent
+type receiver struct {
+	mu     sync.Mutex
+	bodies []string
+	status int
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bodies = append(r.bodies, string(body))
+	if r.status != 0 {
+		w.WriteHeader(r.status)
+	}
+}
+
+func (r *receiver) take() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	bodies := r.bodies
+	r.bodies = nil
+	return bodies
+}
+
+func float(f float64) *float64 {
+	return &f
+}
+
+func TestNotify(t *testing.T) {
+	recv := &receiver{}
+	server := httptest.NewServer(recv)
+	defer server.Close()
+
+	notifier, err := NewNotifier(Config{
+		ResendInterval: "1h",
+		Webhooks:       []Webhook{{URL: server.URL}},
+		Thresholds:     []Threshold{{Name: "low-free-ips", Field: "available_ips", Below: float(10)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	full := []aws.Subnet{{SubnetID: "subnet-1", Name: "private-a", AvailableIPs: 4}}
+	empty := []aws.Subnet{{SubnetID: "subnet-1", Name: "private-a", AvailableIPs: 200}}
+
+	steps := []struct {
+		name    string
+		subnets []aws.Subnet
+		at      time.Duration
+		status  int
+		want    []string
+	}{
+		{name: "fires", subnets: full, at: 0, want: []string{StatusFiring}},
+		{name: "deduplicated", subnets: full, at: 10 * time.Minute},
+		{name: "resent", subnets: full, at: time.Hour, want: []string{StatusFiring}},
+		{name: "resolved", subnets: empty, at: 2 * time.Hour, want: []string{StatusResolved}},
+		{name: "stays resolved", subnets: empty, at: 3 * time.Hour},
+		{name: "receiver failing", subnets: full, at: 4 * time.Hour, status: http.StatusInternalServerError, want: []string{StatusFiring}},
+		{name: "retried after failure", subnets: full, at: 4*time.Hour + time.Minute, want: []string{StatusFiring}},
+	}
+
+	for _, step := range steps {
+		recv.status = step.status
+		notifier.Notify(ctx, step.subnets, start.Add(step.at))
+
+		var got []string
+		for _, body := range recv.take() {
+			var alert Alert
+			if err := json.Unmarshal([]byte(body), &alert); err != nil {
+				t.Fatalf("%s: invalid body %s: %v", step.name, body, err)
+			}
+			if alert.SubnetID != "subnet-1" || alert.Threshold != "low-free-ips" {
+				t.Errorf("%s: unexpected alert %+v", step.name, alert)
+			}
+			got = append(got, alert.Status)
+		}
+		if strings.Join(got, ",") != strings.Join(step.want, ",") {
+			t.Errorf("%s: sent %v, want %v", step.name, got, step.want)
+		}
+	}
+}
+
+func TestNotifyPerWebhook(t *testing.T) {
+	healthy, failing := &receiver{}, &receiver{status: http.StatusInternalServerError}
+	healthyServer, failingServer := httptest.NewServer(healthy), httptest.NewServer(failing)
+	defer healthyServer.Close()
+	defer failingServer.Close()
+
+	notifier, err := NewNotifier(Config{
+		ResendInterval: "1h",
+		Webhooks:       []Webhook{{URL: healthyServer.URL}, {URL: failingServer.URL}},
+		Thresholds:     []Threshold{{Name: "low-free-ips", Field: "available_ips", Below: float(10)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	full := []aws.Subnet{{SubnetID: "subnet-1", AvailableIPs: 4}}
+	empty := []aws.Subnet{{SubnetID: "subnet-1", AvailableIPs: 200}}
+
+	steps := []struct {
+		name          string
+		subnets       []aws.Subnet
+		at            time.Duration
+		failingStatus int
+		wantHealthy   []string
+		wantFailing   []string
+	}{
+		{name: "fires", subnets: full, at: 0, failingStatus: http.StatusInternalServerError, wantHealthy: []string{StatusFiring}, wantFailing: []string{StatusFiring}},
+		{name: "only the failing webhook is retried", subnets: full, at: time.Minute, wantFailing: []string{StatusFiring}},
+		{name: "resolution fails on one webhook", subnets: empty, at: 2 * time.Minute, failingStatus: http.StatusInternalServerError, wantHealthy: []string{StatusResolved}, wantFailing: []string{StatusResolved}},
+		{name: "resolution is retried", subnets: empty, at: 3 * time.Minute, wantFailing: []string{StatusResolved}},
+		{name: "stays resolved", subnets: empty, at: 4 * time.Minute},
+	}
+
+	for _, step := range steps {
+		failing.mu.Lock()
+		failing.status = step.failingStatus
+		failing.mu.Unlock()
+		notifier.Notify(ctx, step.subnets, start.Add(step.at))
+
+		for _, r := range []struct {
+			name string
+			recv *receiver
+			want []string
+		}{{"healthy", healthy, step.wantHealthy}, {"failing", failing, step.wantFailing}} {
+			var got []string
+			for _, body := range r.recv.take() {
+				var alert Alert
+				if err := json.Unmarshal([]byte(body), &alert); err != nil {
+					t.Fatalf("%s: invalid body %s: %v", step.name, body, err)
+				}
+				got = append(got, alert.Status)
+			}
+			if strings.Join(got, ",") != strings.Join(r.want, ",") {
+				t.Errorf("%s: %s webhook was sent %v, want %v", step.name, r.name, got, r.want)
+			}
+		}
+	}
+}
+
+func TestPayloadFormats(t *testing.T) {
+	recv := &receiver{}
+	server := httptest.NewServer(recv)
+	defer server.Close()
+
+	notifier, err := NewNotifier(Config{
+		Webhooks: []Webhook{
+			{URL: server.URL, Format: FormatSlack},
+			{URL: server.URL, Format: FormatTeams},
+			{URL: server.URL, Template: `{"msg": {{ json .Summary }}}`},
+		},
+		Thresholds: []Threshold{{Name: "busy", Field: "utilization_ratio", Above: float(0.5)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifier.Notify(context.Background(), []aws.Subnet{{SubnetID: "subnet-1", TotalIPs: 16, AllocatedIPs: 12}}, time.Now())
+
+	bodies := recv.take()
+	if len(bodies) != 3 {
+		t.Fatalf("sent %d bodies, want 3", len(bodies))
+	}
+	var slack slackMessage
+	if err := json.Unmarshal([]byte(bodies[0]), &slack); err != nil || !strings.Contains(slack.Text, "busy") {
+		t.Errorf("invalid Slack body %s", bodies[0])
+	}
+	var teams teamsMessage
+	if err := json.Unmarshal([]byte(bodies[1]), &teams); err != nil || teams.Type != "MessageCard" || teams.ThemeColor != teamsFiringColor {
+		t.Errorf("invalid Teams body %s", bodies[1])
+	}
+	var custom map[string]string
+	if err := json.Unmarshal([]byte(bodies[2]), &custom); err != nil || !strings.Contains(custom["msg"], "utilization_ratio") {
+		t.Errorf("invalid templated body %s", bodies[2])
+	}
+}
+
+func TestValidate(t *testing.T) {
+	webhooks := []Webhook{{URL: "https://example.com/hook"}}
+	tests := map[string]Config{
+		"no webhooks":      {Thresholds: []Threshold{{Name: "a", Field: "free_ips", Below: float(1)}}},
+		"invalid URL":      {Webhooks: []Webhook{{URL: "example.com"}}},
+		"unknown format":   {Webhooks: []Webhook{{URL: "https://example.com", Format: "xml"}}},
+		"invalid template": {Webhooks: []Webhook{{URL: "https://example.com", Template: "{{ .Missing"}}},
+		"unknown field":    {Webhooks: webhooks, Thresholds: []Threshold{{Name: "a", Field: "free", Below: float(1)}}},
+		"no limit":         {Webhooks: webhooks, Thresholds: []Threshold{{Name: "a", Field: "free_ips"}}},
+		"both limits":      {Webhooks: webhooks, Thresholds: []Threshold{{Name: "a", Field: "free_ips", Below: float(1), Above: float(2)}}},
+		"invalid resend":   {Webhooks: webhooks, ResendInterval: "daily"},
+	}
+	for name, config := range tests {
+		err := config.Validate()
+		if err == nil {
+			t.Errorf("%s: Validate() returned no error", name)
+			continue
+		}
+		for _, w := range config.Webhooks {
+			if strings.Contains(err.Error(), w.URL) {
+				t.Errorf("%s: Validate() error %q shows the webhook URL", name, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// Colours of Teams cards for firing and resolved alerts
+const (
+	teamsFiringColor   = "D93F0B"
+	teamsResolvedColor = "2EB886"
+)
+
+// Body of an incoming webhook of Slack
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+// Body of an incoming webhook of Microsoft Teams, a legacy actionable message card
+type teamsMessage struct {
+	Type       string         `json:"@type"`
+	Context    string         `json:"@context"`
+	ThemeColor string         `json:"themeColor"`
+	Summary    string         `json:"summary"`
+	Title      string         `json:"title"`
+	Sections   []teamsSection `json:"sections"`
+}
+
+type teamsSection struct {
+	Facts []teamsFact `json:"facts"`
+}
+
+type teamsFact struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Render the request body for the webhook
+func (w webhook) payload(alert Alert) ([]byte, error) {
+	if w.template != nil {
+		var buf bytes.Buffer
+		if err := w.template.Execute(&buf, alert); err != nil {
+			return nil, errors.Wrap(err, "cannot render webhook template")
+		}
+		return buf.Bytes(), nil
+	}
+
+	switch w.Format {
+	case FormatSlack:
+		return json.Marshal(slackMessage{Text: alert.Summary()})
+	case FormatTeams:
+		color := teamsFiringColor
+		if alert.Status == StatusResolved {
+			color = teamsResolvedColor
+		}
+		return json.Marshal(teamsMessage{
+			Type:       "MessageCard",
+			Context:    "https://schema.org/extensions",
+			ThemeColor: color,
+			Summary:    alert.Summary(),
+			Title:      "[" + alert.Status + "] " + alert.Threshold,
+			Sections: []teamsSection{{Facts: []teamsFact{
+				{Name: "Subnet", Value: alert.Name + " (" + alert.SubnetID + ")"},
+				{Name: "VPC", Value: alert.VPCID},
+				{Name: "Availability zone", Value: alert.AZ},
+				{Name: alert.Field, Value: jsonString(alert.Value)},
+				{Name: "Limit", Value: jsonString(alert.Limit)},
+			}}},
+		})
+	default:
+		return json.Marshal(alert)
+	}
+}
+
+// Encode a value as JSON for use in templates, e.g. {"text": {{ json .Summary }}}
+func jsonString(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "null"
+	}
+	return string(data)
+}
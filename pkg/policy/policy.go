@@ -0,0 +1,169 @@
+package policy
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/google/cel-go/cel"
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/aws"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+// Policy rule read from the config file, the expression is true when a subnet violates it
+type Rule struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Expression  string `json:"expression"`
+}
+
+// Layout of the policy config file
+type Config struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Compiled policy rules
+type Policy struct {
+	rules []compiledRule
+}
+
+type compiledRule struct {
+	Rule
+	program cel.Program
+}
+
+// Outcome of evaluating one rule against a subnet
+type Result struct {
+	Rule     Rule
+	Violated bool
+	Err      error
+}
+
+// Variables the expressions can use, holding the fields of a subnet
+var variables = []cel.EnvOption{
+	cel.Variable("name", cel.StringType),
+	cel.Variable("subnet_id", cel.StringType),
+	cel.Variable("vpc_id", cel.StringType),
+	cel.Variable("cidr_block", cel.StringType),
+	cel.Variable("az", cel.StringType),
+	cel.Variable("tags", cel.MapType(cel.StringType, cel.StringType)),
+	cel.Variable("available_ips", cel.IntType),
+	cel.Variable("max_ips", cel.IntType),
+	cel.Variable("total_ips", cel.IntType),
+	cel.Variable("allocated_ips", cel.IntType),
+	cel.Variable("free_ips", cel.IntType),
+	cel.Variable("utilization_ratio", cel.DoubleType),
+	cel.Variable("interfaces_in_use", cel.IntType),
+	cel.Variable("trunk_interfaces", cel.IntType),
+	cel.Variable("branch_interfaces", cel.IntType),
+	cel.Variable("used_prefixes", cel.IntType),
+	cel.Variable("available_prefixes", cel.IntType),
+	cel.Variable("max_prefixes", cel.IntType),
+	cel.Variable("reserved_available_prefixes", cel.IntType),
+	cel.Variable("unreserved_available_prefixes", cel.IntType),
+	cel.Variable("explicit_reserved_ips", cel.IntType),
+	cel.Variable("pod_capacity", cel.IntType),
+	cel.Variable("eniconfigs", cel.ListType(cel.StringType)),
+}
+
+// Read the rules from a YAML or JSON config file and compile them
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read policy file")
+	}
+	var config Config
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, errors.Wrapf(err, "cannot parse policy file %s", path)
+	}
+	return Compile(config.Rules)
+}
+
+// Compile the rules, failing on unnamed or duplicate rules and on expressions
+// that do not type check to a bool
+func Compile(rules []Rule) (*Policy, error) {
+	env, err := cel.NewEnv(variables...)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create policy environment")
+	}
+
+	policy := &Policy{}
+	seen := map[string]bool{}
+	for _, r := range rules {
+		if r.Name == "" {
+			return nil, fmt.Errorf("policy rule without a name")
+		}
+		if seen[r.Name] {
+			return nil, fmt.Errorf("duplicate policy rule %s", r.Name)
+		}
+		seen[r.Name] = true
+
+		ast, issues := env.Compile(r.Expression)
+		if issues != nil && issues.Err() != nil {
+			return nil, errors.Wrapf(issues.Err(), "invalid expression in policy rule %s", r.Name)
+		}
+		if ast.OutputType() != cel.BoolType {
+			return nil, fmt.Errorf("expression in policy rule %s returns %s, not bool", r.Name, ast.OutputType())
+		}
+		program, err := env.Program(ast)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid expression in policy rule %s", r.Name)
+		}
+		policy.rules = append(policy.rules, compiledRule{Rule: r, program: program})
+	}
+	return policy, nil
+}
+
+// Evaluate every rule against the subnet. Rules failing at runtime, e.g. reading a
+// tag the subnet does not have, carry the error instead of a verdict.
+func (p *Policy) Evaluate(subnet aws.Subnet) []Result {
+	activation := subnetVariables(subnet)
+	results := make([]Result, 0, len(p.rules))
+	for _, r := range p.rules {
+		result := Result{Rule: r.Rule}
+		out, _, err := r.program.Eval(activation)
+		if err != nil {
+			result.Err = errors.Wrapf(err, "cannot evaluate policy rule %s for subnet %s", r.Name, subnet.SubnetID)
+		} else if violated, ok := out.Value().(bool); ok {
+			result.Violated = violated
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func subnetVariables(s aws.Subnet) map[string]interface{} {
+	tags := s.Tags
+	if tags == nil {
+		tags = map[string]string{}
+	}
+	eniConfigs := s.ENIConfigs
+	if eniConfigs == nil {
+		eniConfigs = []string{}
+	}
+	return map[string]interface{}{
+		"name":                          s.Name,
+		"subnet_id":                     s.SubnetID,
+		"vpc_id":                        s.VPCID,
+		"cidr_block":                    s.CIDRBlock,
+		"az":                            s.AZ,
+		"tags":                          tags,
+		"available_ips":                 int64(s.AvailableIPs),
+		"max_ips":                       int64(s.MaxIPs),
+		"total_ips":                     int64(s.TotalIPs),
+		"allocated_ips":                 int64(s.AllocatedIPs),
+		"free_ips":                      int64(s.FreeIPs),
+		"utilization_ratio":             s.UtilizationRatio(),
+		"interfaces_in_use":             int64(s.InterfacesInUse),
+		"trunk_interfaces":              int64(s.TrunkInterfaces),
+		"branch_interfaces":             int64(s.BranchInterfaces),
+		"used_prefixes":                 int64(s.UsedPrefixes),
+		"available_prefixes":            int64(len(s.AvailablePrefixes)),
+		"max_prefixes":                  int64(s.MaxPrefixes),
+		"reserved_available_prefixes":   int64(s.ReservedAvailablePrefixes),
+		"unreserved_available_prefixes": int64(s.UnreservedAvailablePrefixes),
+		"explicit_reserved_ips":         int64(s.ExplicitReservedIPs),
+		"pod_capacity":                  int64(s.PodCapacity),
+		"eniconfigs":                    eniConfigs,
+	}
+}
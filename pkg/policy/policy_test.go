@@ -0,0 +1,100 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/aws"
+)
+
+func TestEvaluate(t *testing.T) {
+	policy, err := Compile([]Rule{
+		{Name: "private-prefixes", Expression: `tags.tier == "private" && available_prefixes < 10`},
+		{Name: "utilization", Expression: `utilization_ratio > 0.8`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		subnet   aws.Subnet
+		violated map[string]bool
+		errors   map[string]bool
+	}{
+		{
+			name: "private subnet short of prefixes",
+			subnet: aws.Subnet{
+				Tags:              map[string]string{"tier": "private"},
+				AvailablePrefixes: []string{"10.0.0.16/28"},
+				TotalIPs:          256,
+				AllocatedIPs:      64,
+			},
+			violated: map[string]bool{"private-prefixes": true},
+		},
+		{
+			name: "public subnet nearly full",
+			subnet: aws.Subnet{
+				Tags:         map[string]string{"tier": "public"},
+				TotalIPs:     256,
+				AllocatedIPs: 250,
+			},
+			violated: map[string]bool{"utilization": true},
+		},
+		{
+			name:     "untagged subnet",
+			subnet:   aws.Subnet{TotalIPs: 256},
+			violated: map[string]bool{},
+			errors:   map[string]bool{"private-prefixes": true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, r := range policy.Evaluate(tt.subnet) {
+				if (r.Err != nil) != tt.errors[r.Rule.Name] {
+					t.Errorf("rule %s returned error %v", r.Rule.Name, r.Err)
+				}
+				if r.Violated != tt.violated[r.Rule.Name] {
+					t.Errorf("rule %s violated = %v, want %v", r.Rule.Name, r.Violated, tt.violated[r.Rule.Name])
+				}
+			}
+		})
+	}
+}
+
+func TestCompileInvalid(t *testing.T) {
+	tests := map[string][]Rule{
+		"syntax error":   {{Name: "a", Expression: `free_ips <`}},
+		"unknown field":  {{Name: "a", Expression: `free_addresses < 10`}},
+		"not a bool":     {{Name: "a", Expression: `free_ips - 10`}},
+		"missing name":   {{Expression: `free_ips < 10`}},
+		"duplicate name": {{Name: "a", Expression: `free_ips < 10`}, {Name: "a", Expression: `free_ips < 20`}},
+	}
+	for name, rules := range tests {
+		if _, err := Compile(rules); err == nil {
+			t.Errorf("%s: Compile() returned no error", name)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	config := `rules:
+  - name: private-prefixes
+    description: Private subnets need room for prefix delegation
+    expression: 'has(tags.tier) && tags.tier == "private" && available_prefixes < 10'
+`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := policy.Evaluate(aws.Subnet{})
+	if len(results) != 1 || results[0].Err != nil || results[0].Violated {
+		t.Errorf("Evaluate() = %+v, want one rule not violated", results)
+	}
+}
@@ -1,12 +1,16 @@
 package prometheus
 
 import (
-	"github.com/prometheus/client_golang/prometheus"
+	"net/http"
+
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-var Handler = promhttp.HandlerFor(
-	prometheus.DefaultGatherer,
-	promhttp.HandlerOpts{
-		EnableOpenMetrics: true,
-	})
+// Handler serving the metrics held in Registry, RegisterMetrics must be called first
+func Handler() http.Handler {
+	return promhttp.HandlerFor(
+		Registry,
+		promhttp.HandlerOpts{
+			EnableOpenMetrics: true,
+		})
+}
@@ -1,46 +1,387 @@
 package prometheus
 
 import (
+	"fmt"
+	"strings"
+
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/utils"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 )
 
 const (
-	prefix = "aws_subnet_exporter_"
+	// Default namespace prepended to every exported metric name
+	DefaultNamespace = "aws_subnet_exporter"
 )
 
+// Options controls how metrics are named and registered
+type Options struct {
+	// Namespace prepended to every metric name, e.g. aws_subnet_exporter
+	Namespace string
+	// Labels attached to every exported series, e.g. cluster or environment
+	ConstLabels prometheus.Labels
+	// Register the Go runtime and process collectors alongside the subnet metrics
+	RuntimeCollectors bool
+}
+
+// Exported metric as registered, used to generate alerting rules and dashboards that
+// match the running configuration
+type Definition struct {
+	// Name without the namespace, e.g. free_ips
+	Name string
+	// Name with the namespace, e.g. aws_subnet_exporter_free_ips
+	FQName string
+	Help   string
+	Labels []string
+}
+
+// Gauge vectors for capacity summed over a group of subnets
+type AggregateGauges struct {
+	Subnets           *prometheus.GaugeVec
+	TotalIPs          *prometheus.GaugeVec
+	AvailableIPs      *prometheus.GaugeVec
+	FreeIPs           *prometheus.GaugeVec
+	AvailablePrefixes *prometheus.GaugeVec
+	PodCapacity       *prometheus.GaugeVec
+}
+
+// Reset every gauge vector so groups that no longer exist stop being exported
+func (g AggregateGauges) Reset() {
+	g.Subnets.Reset()
+	g.TotalIPs.Reset()
+	g.AvailableIPs.Reset()
+	g.FreeIPs.Reset()
+	g.AvailablePrefixes.Reset()
+	g.PodCapacity.Reset()
+}
+
+// Gauge vectors for the spread of free capacity across availability zones of a group of subnets
+type ImbalanceGauges struct {
+	FreeIPsSkew      *prometheus.GaugeVec
+	FreePrefixesSkew *prometheus.GaugeVec
+}
+
+// Reset every gauge vector so groups that no longer exist stop being exported
+func (g ImbalanceGauges) Reset() {
+	g.FreeIPsSkew.Reset()
+	g.FreePrefixesSkew.Reset()
+}
+
 var (
-	labels = []string{"vpcid", "subnetid", "cidrblock", "az", "name"}
+	labels      = []string{"vpcid", "subnetid", "cidrblock", "az", "name"}
+	vpcLabels   = []string{"vpcid"}
+	azLabels    = []string{"vpcid", "az"}
+	groupLabels = []string{"vpcid", "group_tag", "group_value", "az"}
+
+	tagGroupLabels = []string{"vpcid", "group_tag", "group_value"}
+
+	instanceTypeLabels = append(append([]string{}, labels...), "instance_type")
+	attributionLabels  = append(append([]string{}, labels...), "eks_cluster", "nodegroup")
+	eniConfigLabels    = append(append([]string{}, labels...), "eniconfig")
+	nodeLabels         = append(append([]string{}, labels...), "node")
+	requirementLabels  = append(append([]string{}, labels...), "requirement")
+	ruleLabels         = append(append([]string{}, labels...), "rule")
+	resourceLabels     = append(append([]string{}, labels...), "resource")
+
+	// Every set of variable labels used by a gauge vector, constant labels must not
+	// reuse any of them
+	labelSets = [][]string{
+		labels, vpcLabels, azLabels, groupLabels, tagGroupLabels, instanceTypeLabels, attributionLabels,
+		eniConfigLabels, nodeLabels, requirementLabels, ruleLabels, resourceLabels,
+	}
+
+	// Registry holding every metric exposed by the exporter
+	Registry *prometheus.Registry
+
+	// Definitions of the metrics in the registry, in registration order
+	Definitions []Definition
 
 	// Prometheus gauge vector for available IPs in subnets
-	AvailableIPs = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: prefix + "available_ips",
-		Help: "Available IPs in subnets",
-	}, labels)
+	AvailableIPs *prometheus.GaugeVec
 
 	// Prometheus gauge vector for max IPs in subnets
-	MaxIPs = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: prefix + "max_ips",
-		Help: "Max host IPs in subnet",
-	}, labels)
+	MaxIPs *prometheus.GaugeVec
 
 	// Prometheus gauge vector for used prefixes in subnets
-	UsedPrefixes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: prefix + "used_prefixes",
-		Help: "Used prefixes in subnets",
-	}, labels)
+	UsedPrefixes *prometheus.GaugeVec
 
 	// Prometheus gauge vector for available prefixes in subnets
-	AvailablePrefixes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: prefix + "available_prefixes",
-		Help: "Available prefixes in subnets",
-	}, labels)
+	AvailablePrefixes *prometheus.GaugeVec
+
+	// Prometheus gauge vector for the /28 prefixes that fit in subnets
+	MaxPrefixes *prometheus.GaugeVec
+
+	// Prometheus gauge vector for IPs allocated in subnets as computed from network interfaces
+	AllocatedIPs *prometheus.GaugeVec
+
+	// Prometheus gauge vector for free IPs in subnets as computed from network interfaces
+	FreeIPs *prometheus.GaugeVec
+
+	// Prometheus gauge vector for network interfaces in subnets
+	InterfacesInUse *prometheus.GaugeVec
+
+	// Prometheus gauge vector for trunk network interfaces of security groups for pods in subnets
+	TrunkInterfaces *prometheus.GaugeVec
+
+	// Prometheus gauge vector for branch network interfaces of security groups for pods in subnets
+	BranchInterfaces *prometheus.GaugeVec
+
+	// Prometheus gauge vector for IPs held by branch network interfaces in subnets
+	BranchIPs *prometheus.GaugeVec
+
+	// Prometheus gauge vector for the ratio of allocated to total IPs in subnets
+	UtilizationRatio *prometheus.GaugeVec
+
+	// Prometheus gauge vector for AWS reported minus computed free IPs in subnets
+	AvailableIPsDiscrepancy *prometheus.GaugeVec
+
+	// Prometheus gauge vector for available prefixes inside prefix CIDR reservations
+	ReservedAvailablePrefixes *prometheus.GaugeVec
+
+	// Prometheus gauge vector for available prefixes outside any CIDR reservation
+	UnreservedAvailablePrefixes *prometheus.GaugeVec
+
+	// Prometheus gauge vector for IPs held by explicit CIDR reservations
+	ExplicitReservedIPs *prometheus.GaugeVec
+
+	// Prometheus gauge vector for estimated additional pods that fit in subnets
+	PodCapacity *prometheus.GaugeVec
+
+	// Prometheus gauge vector for estimated additional nodes per instance type that fit in subnets
+	NodeHeadroom *prometheus.GaugeVec
+
+	// Prometheus gauge vector for IPs in subnets used by each EKS cluster and node group
+	AttributedIPs *prometheus.GaugeVec
+
+	// Prometheus gauge vector for prefixes in subnets used by each EKS cluster and node group
+	AttributedPrefixes *prometheus.GaugeVec
+
+	// Prometheus gauge vector for the minimum free IPs set by the threshold tag of subnets
+	MinFreeIPsThreshold *prometheus.GaugeVec
+
+	// Prometheus gauge vector for the minimum free prefixes set by the threshold tag of subnets
+	MinFreePrefixesThreshold *prometheus.GaugeVec
+
+	// Prometheus gauge vector set to 1 for every ENIConfig placing pods in a subnet
+	ENIConfigInfo *prometheus.GaugeVec
 
+	// Prometheus gauge vector for IPs assigned to nodes in subnets that pods use
+	PodIPs *prometheus.GaugeVec
+
+	// Prometheus gauge vector for IPs assigned to nodes in subnets that no pod uses
+	IdleIPs *prometheus.GaugeVec
+
+	// Prometheus gauge vector for IPs assigned to each node in subnets that no pod uses
+	NodeIdleIPs *prometheus.GaugeVec
+
+	// Prometheus gauge vector set to 1 when a subnet has the free IPs a service requirement asks for
+	RequirementSatisfied *prometheus.GaugeVec
+
+	// Prometheus gauge vector for the free IPs a service requirement asks for in subnets
+	RequirementMinFreeIPs *prometheus.GaugeVec
+
+	// Prometheus gauge vector set to 1 when a subnet violates a policy rule
+	PolicyViolation *prometheus.GaugeVec
+
+	// Prometheus gauge vector for the predicted seconds until subnets run out of IPs or prefixes
+	PredictedExhaustionSeconds *prometheus.GaugeVec
+
+	// Prometheus gauge vectors for subnets aggregated per VPC
+	VPCAggregates AggregateGauges
+
+	// Prometheus gauge vectors for subnets aggregated per availability zone
+	AZAggregates AggregateGauges
+
+	// Prometheus gauge vectors for subnets aggregated per tag value and availability zone
+	GroupAggregates AggregateGauges
+
+	// Prometheus gauge vectors for the imbalance between availability zones of each VPC
+	VPCImbalance ImbalanceGauges
+
+	// Prometheus gauge vector for addresses in the CIDR blocks of VPCs
+	VPCCIDRIPs *prometheus.GaugeVec
+
+	// Prometheus gauge vector for addresses in VPCs not allocated to subnets
+	VPCUnallocatedIPs *prometheus.GaugeVec
+
+	// Prometheus gauge vector for addresses in the largest free aligned block of VPCs
+	VPCLargestFreeBlockIPs *prometheus.GaugeVec
+
+	// Prometheus gauge vector for the prefix length of the largest free aligned block of VPCs
+	VPCLargestFreeBlockPrefixLength *prometheus.GaugeVec
+
+	// Prometheus gauge vectors for the imbalance between availability zones of each tag group
+	GroupImbalance ImbalanceGauges
+
+	// Prometheus gauge for the time the last refresh of subnets finished
+	LastRefreshTimestamp prometheus.Gauge
+
+	// Prometheus gauge for the time the last refresh of subnets took
+	RefreshDuration prometheus.Gauge
 )
 
 // Prometheus register metrics
-func RegisterMetrics() {
-	prometheus.MustRegister(AvailableIPs)
-	prometheus.MustRegister(MaxIPs)
-	prometheus.MustRegister(UsedPrefixes)
-	prometheus.MustRegister(AvailablePrefixes)
+func RegisterMetrics(opts Options) error {
+	if opts.Namespace == "" {
+		opts.Namespace = DefaultNamespace
+	}
+	if !isValidLabelName(opts.Namespace) {
+		return fmt.Errorf("invalid namespace: %q", opts.Namespace)
+	}
+	Registry = prometheus.NewRegistry()
+	Definitions = nil
+
+	AvailableIPs = newGaugeVec(opts, "available_ips", "Available IPs in subnets", labels)
+	MaxIPs = newGaugeVec(opts, "max_ips", "Total IPs in the subnet CIDR, including the 5 AWS reserved IPs", labels)
+	UsedPrefixes = newGaugeVec(opts, "used_prefixes", "Used prefixes in subnets", labels)
+	AvailablePrefixes = newGaugeVec(opts, "available_prefixes", "Available prefixes in subnets", labels)
+	MaxPrefixes = newGaugeVec(opts, "max_prefixes", "Max /28 prefixes in subnet", labels)
+	AllocatedIPs = newGaugeVec(opts, "allocated_ips", "IPs allocated in subnets, computed from network interface IPs, delegated prefixes and the 5 AWS reserved IPs", labels)
+	FreeIPs = newGaugeVec(opts, "free_ips", "Free IPs in subnets, computed as subnet size minus allocated IPs", labels)
+	InterfacesInUse = newGaugeVec(opts, "interfaces_in_use", "Network interfaces in subnets", labels)
+	TrunkInterfaces = newGaugeVec(opts, "trunk_interfaces", "Trunk network interfaces of security groups for pods in subnets", labels)
+	BranchInterfaces = newGaugeVec(opts, "branch_interfaces", "Branch network interfaces of security groups for pods in subnets", labels)
+	BranchIPs = newGaugeVec(opts, "branch_ips", "IPs held by branch network interfaces in subnets", labels)
+	UtilizationRatio = newGaugeVec(opts, "utilization_ratio", "Ratio of allocated IPs to subnet size, between 0 and 1", labels)
+	AvailableIPsDiscrepancy = newGaugeVec(opts, "available_ips_discrepancy", "AWS reported available IPs minus computed free IPs in subnets", labels)
+	ReservedAvailablePrefixes = newGaugeVec(opts, "reserved_available_prefixes", "Available prefixes inside prefix CIDR reservations in subnets", labels)
+	UnreservedAvailablePrefixes = newGaugeVec(opts, "unreserved_available_prefixes", "Available prefixes outside any CIDR reservation in subnets", labels)
+	ExplicitReservedIPs = newGaugeVec(opts, "explicit_reserved_ips", "IPs held by explicit CIDR reservations in subnets", labels)
+	PodCapacity = newGaugeVec(opts, "pod_capacity", "Estimated additional pods that fit in subnets given the VPC CNI configuration", labels)
+	NodeHeadroom = newGaugeVec(opts, "node_headroom", "Estimated additional nodes of the instance type that can launch into subnets", instanceTypeLabels)
+	AttributedIPs = newGaugeVec(opts, "attributed_ips", "IPs on network interfaces in subnets per EKS cluster and node group", attributionLabels)
+	AttributedPrefixes = newGaugeVec(opts, "attributed_prefixes", "Delegated prefixes in subnets per EKS cluster and node group", attributionLabels)
+	MinFreeIPsThreshold = newGaugeVec(opts, "min_free_ips_threshold", "Minimum free IPs of subnets from the aws-subnet-exporter/min-free-ips tag", labels)
+	MinFreePrefixesThreshold = newGaugeVec(opts, "min_free_prefixes_threshold", "Minimum available prefixes of subnets from the aws-subnet-exporter/min-free-prefixes tag", labels)
+	ENIConfigInfo = newGaugeVec(opts, "eniconfig_info", "ENIConfigs placing pods in subnets with EKS custom networking", eniConfigLabels)
+	PodIPs = newGaugeVec(opts, "pod_ips", "IPs assigned to nodes in subnets that are used by pods", labels)
+	IdleIPs = newGaugeVec(opts, "idle_ips", "IPs assigned to nodes in subnets that are not used by any pod", labels)
+	NodeIdleIPs = newGaugeVec(opts, "node_idle_ips", "IPs assigned to a node in subnets that are not used by any pod", nodeLabels)
+	RequirementSatisfied = newGaugeVec(opts, "requirement_satisfied", "Whether subnets have the free IPs an AWS service requirement asks for", requirementLabels)
+	RequirementMinFreeIPs = newGaugeVec(opts, "requirement_min_free_ips", "Free IPs an AWS service requirement asks for in subnets", requirementLabels)
+	PolicyViolation = newGaugeVec(opts, "policy_violation", "Whether subnets violate a policy rule", ruleLabels)
+	PredictedExhaustionSeconds = newGaugeVec(opts, "predicted_exhaustion_seconds", "Predicted seconds until subnets run out of free IPs or prefixes at the current trend", resourceLabels)
+
+	VPCAggregates = newAggregateGauges(opts, "vpc", "VPC", vpcLabels)
+	AZAggregates = newAggregateGauges(opts, "az", "availability zone", azLabels)
+	GroupAggregates = newAggregateGauges(opts, "group", "tag group and availability zone", groupLabels)
+	VPCImbalance = newImbalanceGauges(opts, "vpc", "VPC", vpcLabels)
+	VPCCIDRIPs = newGaugeVec(opts, "vpc_cidr_ips", "Addresses in the primary and secondary CIDR blocks of VPCs", vpcLabels)
+	VPCUnallocatedIPs = newGaugeVec(opts, "vpc_unallocated_ips", "Addresses in VPCs not allocated to any subnet", vpcLabels)
+	VPCLargestFreeBlockIPs = newGaugeVec(opts, "vpc_largest_free_block_ips", "Addresses in the largest free aligned block of VPCs, 0 when no subnet fits", vpcLabels)
+	VPCLargestFreeBlockPrefixLength = newGaugeVec(opts, "vpc_largest_free_block_prefix_length", "Prefix length of the largest free aligned block of VPCs where a new subnet could go", vpcLabels)
+	GroupImbalance = newImbalanceGauges(opts, "group", "tag group", tagGroupLabels)
+	LastRefreshTimestamp = newGauge(opts, "last_refresh_timestamp_seconds", "Unix time the last refresh of subnets finished")
+	RefreshDuration = newGauge(opts, "refresh_duration_seconds", "Seconds the last refresh of subnets took")
+
+	if opts.RuntimeCollectors {
+		Registry.MustRegister(collectors.NewGoCollector())
+		Registry.MustRegister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	}
+	return nil
+}
+
+// Create a gauge vector in the configured namespace and register it
+func newGaugeVec(opts Options, name, help string, labelNames []string) *prometheus.GaugeVec {
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   opts.Namespace,
+		Name:        name,
+		Help:        help,
+		ConstLabels: opts.ConstLabels,
+	}, labelNames)
+	Registry.MustRegister(gauge)
+	Definitions = append(Definitions, Definition{
+		Name:   name,
+		FQName: prometheus.BuildFQName(opts.Namespace, "", name),
+		Help:   help,
+		Labels: labelNames,
+	})
+	return gauge
+}
+
+// Create a gauge without labels in the configured namespace and register it
+func newGauge(opts Options, name, help string) prometheus.Gauge {
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   opts.Namespace,
+		Name:        name,
+		Help:        help,
+		ConstLabels: opts.ConstLabels,
+	})
+	Registry.MustRegister(gauge)
+	Definitions = append(Definitions, Definition{
+		Name:   name,
+		FQName: prometheus.BuildFQName(opts.Namespace, "", name),
+		Help:   help,
+	})
+	return gauge
+}
+
+// Definition of the metric with the given name without namespace
+func Lookup(name string) (Definition, bool) {
+	for _, d := range Definitions {
+		if d.Name == name {
+			return d, true
+		}
+	}
+	return Definition{}, false
+}
+
+// Create the gauge vectors for subnets aggregated per scope, e.g. vpc_free_ips
+func newAggregateGauges(opts Options, scope, description string, labelNames []string) AggregateGauges {
+	return AggregateGauges{
+		Subnets:           newGaugeVec(opts, scope+"_subnets", "Subnets per "+description, labelNames),
+		TotalIPs:          newGaugeVec(opts, scope+"_total_ips", "Total IPs in subnets per "+description, labelNames),
+		AvailableIPs:      newGaugeVec(opts, scope+"_available_ips", "AWS reported available IPs in subnets per "+description, labelNames),
+		FreeIPs:           newGaugeVec(opts, scope+"_free_ips", "Computed free IPs in subnets per "+description, labelNames),
+		AvailablePrefixes: newGaugeVec(opts, scope+"_available_prefixes", "Available prefixes in subnets per "+description, labelNames),
+		PodCapacity:       newGaugeVec(opts, scope+"_pod_capacity", "Estimated additional pods that fit in subnets per "+description, labelNames),
+	}
+}
+
+// Create the gauge vectors for availability zone imbalance per scope, e.g. vpc_az_free_ips_skew
+func newImbalanceGauges(opts Options, scope, description string, labelNames []string) ImbalanceGauges {
+	return ImbalanceGauges{
+		FreeIPsSkew:      newGaugeVec(opts, scope+"_az_free_ips_skew", "Free IPs in the emptiest minus the fullest availability zone per "+description, labelNames),
+		FreePrefixesSkew: newGaugeVec(opts, scope+"_az_free_prefixes_skew", "Free prefixes in the emptiest minus the fullest availability zone per "+description, labelNames),
+	}
+}
+
+// Parse constant labels given as a comma separated list of key=value pairs
+func ParseConstLabels(s string) (prometheus.Labels, error) {
+	labels, err := utils.ParseLabels(s)
+	if err != nil {
+		return nil, err
+	}
+	for key := range labels {
+		if !isValidLabelName(key) {
+			return nil, fmt.Errorf("invalid label name: %q", key)
+		}
+		if reservedLabel(key) {
+			return nil, fmt.Errorf("label %q clashes with a label of an exported metric", key)
+		}
+	}
+	return prometheus.Labels(labels), nil
+}
+
+func reservedLabel(name string) bool {
+	for _, set := range labelSets {
+		for _, l := range set {
+			if l == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isValidLabelName(name string) bool {
+	if name == "" || strings.HasPrefix(name, "__") {
+		return false
+	}
+	for i, c := range name {
+		if !(c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (i > 0 && c >= '0' && c <= '9')) {
+			return false
+		}
+	}
+	return true
 }
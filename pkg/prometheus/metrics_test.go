@@ -0,0 +1,119 @@
+package prometheus
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestParseConstLabels(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		want      prometheus.Labels
+		expectErr bool
+	}{
+		{
+			name:      "Empty string",
+			input:     "",
+			want:      prometheus.Labels{},
+			expectErr: false,
+		},
+		{
+			name:      "Multiple labels",
+			input:     "cluster=live, environment=production,exporter_instance=a",
+			want:      prometheus.Labels{"cluster": "live", "environment": "production", "exporter_instance": "a"},
+			expectErr: false,
+		},
+		{
+			name:      "Missing value separator",
+			input:     "cluster",
+			want:      nil,
+			expectErr: true,
+		},
+		{
+			name:      "Duplicate label",
+			input:     "env=a,env=b",
+			want:      nil,
+			expectErr: true,
+		},
+		{
+			name:      "Invalid label name",
+			input:     "1cluster=live",
+			want:      nil,
+			expectErr: true,
+		},
+		{
+			name:      "Clashes with subnet label",
+			input:     "vpcid=vpc-123",
+			want:      nil,
+			expectErr: true,
+		},
+		{
+			name:      "Clashes with label of one metric",
+			input:     "node=a",
+			want:      nil,
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseConstLabels(tt.input)
+			if (err != nil) != tt.expectErr {
+				t.Errorf("ParseConstLabels() error = %v, expectErr %v", err, tt.expectErr)
+				return
+			}
+			if tt.expectErr {
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("ParseConstLabels() = %v, want %v", got, tt.want)
+				return
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("ParseConstLabels() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRegisterMetricsInvalidNamespace(t *testing.T) {
+	for _, namespace := range []string{"my-ns", "1subnets", "__subnets"} {
+		if err := RegisterMetrics(Options{Namespace: namespace}); err == nil {
+			t.Errorf("RegisterMetrics() accepted namespace %q", namespace)
+		}
+	}
+}
+
+func TestRegisterMetricsWithConstLabels(t *testing.T) {
+	constLabels, err := ParseConstLabels("cluster=x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterMetrics(Options{ConstLabels: constLabels}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, d := range Definitions {
+		for _, l := range d.Labels {
+			if !reservedLabel(l) {
+				t.Errorf("label %s of %s is not reserved from constant labels", l, d.Name)
+			}
+		}
+	}
+}
+
+func TestRegisterMetricsRefreshGauges(t *testing.T) {
+	if err := RegisterMetrics(Options{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"last_refresh_timestamp_seconds", "refresh_duration_seconds"} {
+		d, ok := Lookup(name)
+		if !ok || d.FQName != DefaultNamespace+"_"+name || len(d.Labels) != 0 {
+			t.Errorf("Lookup(%q) = %+v, %v", name, d, ok)
+		}
+	}
+}
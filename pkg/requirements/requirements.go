@@ -0,0 +1,131 @@
+package requirements
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/aws"
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/utils"
+)
+
+const (
+	// Subnet tag listing requirements by name, for services that leave no tag of their own
+	RequirementsTag = "aws-subnet-exporter/requirements"
+)
+
+// Free IPs an AWS service needs in a subnet to scale or upgrade
+type Requirement struct {
+	Name       string
+	MinFreeIPs int
+	// Tag keys selecting the subnets the requirement applies to, a key ending in *
+	// matches every key starting with the rest of it. Subnets listing the requirement
+	// in the RequirementsTag are selected as well.
+	Tags []string
+}
+
+// Requirements of AWS services, load balancer and EKS subnets are found by the
+// tags Kubernetes uses to discover them
+var Builtin = []Requirement{
+	// load balancers need at least 8 free IPs in every subnet to scale
+	{Name: "elb", MinFreeIPs: 8, Tags: []string{"kubernetes.io/role/elb"}},
+	{Name: "internal-elb", MinFreeIPs: 8, Tags: []string{"kubernetes.io/role/internal-elb"}},
+	// EKS places up to 4 control plane network interfaces per subnet, AWS asks for at least 6 free IPs
+	{Name: "eks-control-plane", MinFreeIPs: 6, Tags: []string{"kubernetes.io/cluster/*"}},
+	// room for a Multi-AZ failover or blue/green deployment of a database instance
+	{Name: "rds", MinFreeIPs: 4},
+	// room for new Hyperplane network interfaces when functions scale out
+	{Name: "lambda", MinFreeIPs: 16},
+}
+
+// Outcome of checking one requirement against a subnet
+type Result struct {
+	Requirement Requirement
+	FreeIPs     int
+}
+
+// Whether the subnet has the free IPs the requirement asks for
+func (r Result) Satisfied() bool {
+	return r.FreeIPs >= r.Requirement.MinFreeIPs
+}
+
+// Parse comma separated requirements in the form name:min-free-ips[:tag key...],
+// e.g. opensearch:12:aws-subnet-exporter/opensearch
+func Parse(s string) ([]Requirement, error) {
+	var requirements []Requirement
+	for _, item := range utils.SplitList(s) {
+		parts := strings.Split(item, ":")
+		if len(parts) < 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid requirement %q, must be name:min-free-ips[:tag]", item)
+		}
+		minFreeIPs, err := strconv.Atoi(parts[1])
+		if err != nil || minFreeIPs < 0 {
+			return nil, fmt.Errorf("invalid minimum free IPs in requirement %q", item)
+		}
+		requirement := Requirement{Name: parts[0], MinFreeIPs: minFreeIPs}
+		if len(parts) > 2 {
+			requirement.Tags = parts[2:]
+		}
+		requirements = append(requirements, requirement)
+	}
+	return requirements, nil
+}
+
+// Combine requirements, later ones replacing earlier ones of the same name. A later
+// requirement without tags keeps the tags of the one it replaces, so raising the free
+// IPs of a built in requirement does not stop it from applying.
+func Merge(sets ...[]Requirement) []Requirement {
+	index := map[string]int{}
+	var merged []Requirement
+	for _, set := range sets {
+		for _, r := range set {
+			if i, ok := index[r.Name]; ok {
+				if len(r.Tags) == 0 {
+					r.Tags = merged[i].Tags
+				}
+				merged[i] = r
+				continue
+			}
+			index[r.Name] = len(merged)
+			merged = append(merged, r)
+		}
+	}
+	return merged
+}
+
+// Check the requirements that apply to the subnet against the free IPs AWS reports for it
+func Evaluate(subnet aws.Subnet, requirements []Requirement) []Result {
+	listed := map[string]bool{}
+	for _, name := range utils.SplitList(subnet.Tags[RequirementsTag]) {
+		listed[name] = true
+	}
+
+	var results []Result
+	for _, r := range requirements {
+		if listed[r.Name] || matchesTags(subnet.Tags, r.Tags) {
+			results = append(results, Result{Requirement: r, FreeIPs: int(subnet.AvailableIPs)})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Requirement.Name < results[j].Requirement.Name
+	})
+	return results
+}
+
+func matchesTags(tags map[string]string, keys []string) bool {
+	for _, key := range keys {
+		if prefix := strings.TrimSuffix(key, "*"); prefix != key {
+			for k := range tags {
+				if strings.HasPrefix(k, prefix) {
+					return true
+				}
+			}
+			continue
+		}
+		if _, ok := tags[key]; ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package requirements
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ministryofjustice/aws-subnet-exporter/pkg/aws"
+)
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name      string
+		subnet    aws.Subnet
+		satisfied map[string]bool
+	}{
+		{
+			name:      "untagged subnet",
+			subnet:    aws.Subnet{AvailableIPs: 100},
+			satisfied: map[string]bool{},
+		},
+		{
+			name: "public load balancer subnet running low",
+			subnet: aws.Subnet{
+				AvailableIPs: 7,
+				Tags:         map[string]string{"kubernetes.io/role/elb": "1"},
+			},
+			satisfied: map[string]bool{"elb": false},
+		},
+		{
+			name: "cluster subnet with enough room",
+			subnet: aws.Subnet{
+				AvailableIPs: 6,
+				Tags: map[string]string{
+					"kubernetes.io/cluster/live":      "shared",
+					"kubernetes.io/role/internal-elb": "1",
+				},
+			},
+			satisfied: map[string]bool{"eks-control-plane": true, "internal-elb": false},
+		},
+		{
+			name: "requirements listed in tag",
+			subnet: aws.Subnet{
+				AvailableIPs: 10,
+				Tags:         map[string]string{RequirementsTag: "rds, lambda"},
+			},
+			satisfied: map[string]bool{"rds": true, "lambda": false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := map[string]bool{}
+			for _, r := range Evaluate(tt.subnet, Builtin) {
+				got[r.Requirement.Name] = r.Satisfied()
+			}
+			if !reflect.DeepEqual(got, tt.satisfied) {
+				t.Errorf("Evaluate() = %v, want %v", got, tt.satisfied)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	got, err := Parse("opensearch:12:aws-subnet-exporter/opensearch, elb:10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Requirement{
+		{Name: "opensearch", MinFreeIPs: 12, Tags: []string{"aws-subnet-exporter/opensearch"}},
+		{Name: "elb", MinFreeIPs: 10},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse() = %+v, want %+v", got, want)
+	}
+
+	merged := Merge(Builtin, got)
+	if len(merged) != len(Builtin)+1 || merged[0].MinFreeIPs != 10 {
+		t.Errorf("Merge() = %+v, want elb replaced and opensearch added", merged)
+	}
+
+	// an override without tags still applies to subnets with the tags of the built in requirement
+	results := Evaluate(aws.Subnet{AvailableIPs: 9, Tags: map[string]string{"kubernetes.io/role/elb": "1"}}, merged)
+	if len(results) != 1 || results[0].Requirement.Name != "elb" || results[0].Satisfied() {
+		t.Errorf("Evaluate() = %+v, want the overridden elb requirement unsatisfied", results)
+	}
+
+	for _, invalid := range []string{"elb", "elb:many", ":8", "elb:-1"} {
+		if _, err := Parse(invalid); err == nil {
+			t.Errorf("Parse(%q) returned no error", invalid)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package utils
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+)
+
+// Parse IPv4 CIDR blocks, masking away any host bits
+func ParsePrefixes(cidrs []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR block: %w", err)
+		}
+		if !prefix.Addr().Is4() {
+			return nil, fmt.Errorf("not an IPv4 CIDR block: %s", cidr)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// Number of addresses in a prefix
+func PrefixSize(prefix netip.Prefix) int {
+	return 1 << (prefix.Addr().BitLen() - prefix.Bits())
+}
+
+// Split the address space into the largest aligned blocks that do not overlap any
+// of the used prefixes, sorted by address
+func FreeBlocks(space []netip.Prefix, used []netip.Prefix) []netip.Prefix {
+	var free []netip.Prefix
+	for _, prefix := range space {
+		free = appendFreeBlocks(free, prefix, used)
+	}
+	sort.Slice(free, func(i, j int) bool {
+		return free[i].Addr().Less(free[j].Addr())
+	})
+	return free
+}
+
+func appendFreeBlocks(free []netip.Prefix, prefix netip.Prefix, used []netip.Prefix) []netip.Prefix {
+	overlapping := false
+	for _, u := range used {
+		if !u.Overlaps(prefix) {
+			continue
+		}
+		if u.Bits() <= prefix.Bits() {
+			// the whole block is in use
+			return free
+		}
+		overlapping = true
+	}
+	if !overlapping {
+		return append(free, prefix)
+	}
+
+	lower, upper := splitPrefix(prefix)
+	free = appendFreeBlocks(free, lower, used)
+	return appendFreeBlocks(free, upper, used)
+}
+
+// Split a prefix into its two halves
+func splitPrefix(prefix netip.Prefix) (netip.Prefix, netip.Prefix) {
+	bits := prefix.Bits() + 1
+	lower := netip.PrefixFrom(prefix.Addr(), bits)
+	upper := netip.PrefixFrom(uint32ToAddr(addrToUint32(prefix.Addr())+uint32(1)<<(32-bits)), bits)
+	return lower, upper
+}
+
+func addrToUint32(addr netip.Addr) uint32 {
+	b := addr.As4()
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+}
+
+func uint32ToAddr(v uint32) netip.Addr {
+	return netip.AddrFrom4([4]byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)})
+}
+
+// Largest block out of the free blocks with a prefix length of at most maxBits, the
+// lowest address wins ties
+func LargestBlock(blocks []netip.Prefix, maxBits int) (netip.Prefix, bool) {
+	var largest netip.Prefix
+	found := false
+	for _, b := range blocks {
+		if b.Bits() > maxBits {
+			continue
+		}
+		if !found || b.Bits() < largest.Bits() {
+			largest = b
+			found = true
+		}
+	}
+	return largest, found
+}
+
+// Carve up to count blocks with the given prefix length out of the free blocks.
+// Smaller free blocks are used first so large contiguous ranges stay available.
+func SuggestCIDRs(free []netip.Prefix, bits int, count int) []netip.Prefix {
+	blocks := make([]netip.Prefix, len(free))
+	copy(blocks, free)
+	sort.SliceStable(blocks, func(i, j int) bool {
+		if blocks[i].Bits() != blocks[j].Bits() {
+			return blocks[i].Bits() > blocks[j].Bits()
+		}
+		return blocks[i].Addr().Less(blocks[j].Addr())
+	})
+
+	var suggestions []netip.Prefix
+	for _, block := range blocks {
+		if block.Bits() > bits {
+			continue
+		}
+		start := addrToUint32(block.Addr())
+		step := uint64(1) << (32 - bits)
+		end := uint64(start) + uint64(PrefixSize(block))
+		for addr := uint64(start); addr < end; addr += step {
+			if len(suggestions) >= count {
+				return suggestions
+			}
+			suggestions = append(suggestions, netip.PrefixFrom(uint32ToAddr(uint32(addr)), bits))
+		}
+	}
+	return suggestions
+}
+
+// Sort prefixes by their distance to the closest of the anchor prefixes
+func SortByProximity(prefixes []netip.Prefix, anchors []netip.Prefix) {
+	if len(anchors) == 0 {
+		return
+	}
+	distance := func(p netip.Prefix) uint32 {
+		closest := ^uint32(0)
+		a := addrToUint32(p.Addr())
+		for _, anchor := range anchors {
+			b := addrToUint32(anchor.Addr())
+			d := a - b
+			if b > a {
+				d = b - a
+			}
+			if d < closest {
+				closest = d
+			}
+		}
+		return closest
+	}
+	sort.SliceStable(prefixes, func(i, j int) bool {
+		return distance(prefixes[i]) < distance(prefixes[j])
+	})
+}
@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestFreeBlocks(t *testing.T) {
+	tests := []struct {
+		name  string
+		space []string
+		used  []string
+		want  []string
+	}{
+		{
+			name:  "Empty VPC",
+			space: []string{"10.0.0.0/16"},
+			used:  []string{},
+			want:  []string{"10.0.0.0/16"},
+		},
+		{
+			name:  "Full VPC",
+			space: []string{"10.0.0.0/24"},
+			used:  []string{"10.0.0.0/25", "10.0.0.128/25"},
+			want:  []string{},
+		},
+		{
+			name:  "Subnet at the start",
+			space: []string{"10.0.0.0/22"},
+			used:  []string{"10.0.0.0/24"},
+			want:  []string{"10.0.1.0/24", "10.0.2.0/23"},
+		},
+		{
+			name:  "Subnets in the middle and a secondary CIDR",
+			space: []string{"10.0.0.0/22", "100.64.0.0/24"},
+			used:  []string{"10.0.1.0/24", "10.0.2.128/25"},
+			want:  []string{"10.0.0.0/24", "10.0.2.0/25", "10.0.3.0/24", "100.64.0.0/24"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			space, err := ParsePrefixes(tt.space)
+			if err != nil {
+				t.Fatal(err)
+			}
+			used, err := ParsePrefixes(tt.used)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := FreeBlocks(space, used)
+			if !equalPrefixes(got, tt.want) {
+				t.Errorf("FreeBlocks() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLargestBlock(t *testing.T) {
+	blocks, _ := ParsePrefixes([]string{"10.0.0.0/25", "10.0.1.0/24", "10.0.2.0/24"})
+	got, ok := LargestBlock(blocks, 28)
+	if !ok || got.String() != "10.0.1.0/24" {
+		t.Errorf("LargestBlock() = %v, %v, want 10.0.1.0/24, true", got, ok)
+	}
+	if _, ok := LargestBlock(nil, 28); ok {
+		t.Errorf("LargestBlock(nil) found a block")
+	}
+	small, _ := ParsePrefixes([]string{"10.0.0.16/29", "10.0.0.24/30"})
+	if got, ok := LargestBlock(small, 28); ok {
+		t.Errorf("LargestBlock() of blocks smaller than /28 = %v, want none", got)
+	}
+}
+
+// helper for comparing prefixes with their string form
+func equalPrefixes(got []netip.Prefix, want []string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i].String() != want[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+// AWS reserves the first four addresses of every subnet and the last one
+const awsReservedLeadingIPs = 4
+
+// Most free IPs a single call returns
+const MaxFreeIPs = 256
+
+// First free IPs of a subnet, in address order. Skips the addresses AWS reserves, every
+// CIDR reservation, the delegated prefixes and the IPs in use as found by EnrichIPsAndPrefixes.
+// Reservations and delegated prefixes are skipped as whole blocks, so the cost grows with
+// the IPs in use and the count rather than the size of the subnet.
+func FreeIPs(cidr string, reservations []CIDRReservation, prefixesInUse map[string]bool, ipsInUse map[string]bool, count int) ([]string, error) {
+	if count <= 0 || count > MaxFreeIPs {
+		return nil, fmt.Errorf("count must be between 1 and %d: %d", MaxFreeIPs, count)
+	}
+	subnets, err := ParsePrefixes([]string{cidr})
+	if err != nil {
+		return nil, err
+	}
+	subnet := subnets[0]
+
+	var reserved []netip.Prefix
+	for _, r := range reservations {
+		prefix, err := netip.ParsePrefix(r.CIDR)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR reservation: %w", err)
+		}
+		if prefix.Addr().Is4() {
+			reserved = append(reserved, prefix.Masked())
+		}
+	}
+	delegated := map[netip.Prefix]bool{}
+	delegatedBits := map[int]bool{}
+	for p := range prefixesInUse {
+		prefix, err := netip.ParsePrefix(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid delegated prefix: %w", err)
+		}
+		if prefix.Addr().Is4() {
+			delegated[prefix.Masked()] = true
+			delegatedBits[prefix.Bits()] = true
+		}
+	}
+
+	first := addrToUint32(subnet.Addr()) + awsReservedLeadingIPs
+	last := addrToUint32(subnet.Addr()) + uint32(PrefixSize(subnet)) - 1 - (AWSReservedIPs - awsReservedLeadingIPs)
+	free := []string{}
+	for v := first; v <= last && len(free) < count; {
+		addr := uint32ToAddr(v)
+		if block, ok := skippedBlock(addr, reserved, delegated, delegatedBits); ok {
+			end := addrToUint32(block.Addr()) + uint32(PrefixSize(block)) - 1
+			if end >= last {
+				break
+			}
+			v = end + 1
+			continue
+		}
+		if !ipsInUse[addr.String()] {
+			free = append(free, addr.String())
+		}
+		v++
+	}
+	return free, nil
+}
+
+// Reservation or delegated prefix containing the address. Delegated prefixes are looked
+// up by the block of each of their lengths, as a subnet can hold thousands of them.
+func skippedBlock(addr netip.Addr, reserved []netip.Prefix, delegated map[netip.Prefix]bool, delegatedBits map[int]bool) (netip.Prefix, bool) {
+	for _, p := range reserved {
+		if p.Contains(addr) {
+			return p, true
+		}
+	}
+	for bits := range delegatedBits {
+		if block, err := addr.Prefix(bits); err == nil && delegated[block] {
+			return block, true
+		}
+	}
+	return netip.Prefix{}, false
+}
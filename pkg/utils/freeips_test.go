@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestFreeIPs(t *testing.T) {
+	// every /28 of a /16 but the last is delegated
+	delegated := map[string]bool{}
+	for i := 0; i < 4095; i++ {
+		delegated[fmt.Sprintf("10.0.%d.%d/28", i/16, i%16*16)] = true
+	}
+
+	tests := []struct {
+		name          string
+		cidr          string
+		reservations  []CIDRReservation
+		prefixesInUse map[string]bool
+		ipsInUse      map[string]bool
+		count         int
+		want          []string
+	}{
+		{
+			name:  "Skips the AWS reserved IPs",
+			cidr:  "10.0.0.0/28",
+			count: 20,
+			want:  []string{"10.0.0.4", "10.0.0.5", "10.0.0.6", "10.0.0.7", "10.0.0.8", "10.0.0.9", "10.0.0.10", "10.0.0.11", "10.0.0.12", "10.0.0.13", "10.0.0.14"},
+		},
+		{
+			name:     "Skips IPs in use",
+			cidr:     "10.0.0.0/24",
+			ipsInUse: map[string]bool{"10.0.0.4": true, "10.0.0.6": true},
+			count:    3,
+			want:     []string{"10.0.0.5", "10.0.0.7", "10.0.0.8"},
+		},
+		{
+			name:          "Skips delegated prefixes and reservations",
+			cidr:          "10.0.0.0/24",
+			reservations:  []CIDRReservation{{CIDR: "10.0.0.0/28", Type: ReservationTypeExplicit}, {CIDR: "10.0.0.32/28", Type: ReservationTypePrefix}},
+			prefixesInUse: map[string]bool{"10.0.0.16/28": true},
+			ipsInUse:      map[string]bool{"10.0.0.48": true},
+			count:         2,
+			want:          []string{"10.0.0.49", "10.0.0.50"},
+		},
+		{
+			name:          "Skips delegated prefixes of a large subnet",
+			cidr:          "10.0.0.0/16",
+			reservations:  []CIDRReservation{{CIDR: "2a05:d01c::/80", Type: ReservationTypeExplicit}},
+			prefixesInUse: delegated,
+			ipsInUse:      map[string]bool{"10.0.255.240": true},
+			count:         2,
+			want:          []string{"10.0.255.241", "10.0.255.242"},
+		},
+		{
+			name:     "Full subnet",
+			cidr:     "10.0.0.0/28",
+			ipsInUse: map[string]bool{},
+			reservations: []CIDRReservation{
+				{CIDR: "10.0.0.0/28", Type: ReservationTypeExplicit},
+			},
+			count: 5,
+			want:  []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FreeIPs(tt.cidr, tt.reservations, tt.prefixesInUse, tt.ipsInUse, tt.count)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("FreeIPs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	for _, count := range []int{0, MaxFreeIPs + 1} {
+		if _, err := FreeIPs("10.0.0.0/24", nil, nil, nil, count); err == nil {
+			t.Errorf("FreeIPs() accepted a count of %d", count)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math"
 	"net"
+	"net/netip"
 	"strconv"
 	"strings"
 
@@ -14,6 +15,13 @@ import (
 	"github.com/pkg/errors"
 )
 
+const (
+    // Number of IPs AWS reserves in every subnet
+    AWSReservedIPs = 5
+    // Number of IPs in a delegated /28 prefix
+    IPsPerPrefix = 16
+)
+
 type SubnetDetails struct {
     SubnetCIDR          string
     SubnetMask          int
@@ -23,11 +31,22 @@ type SubnetDetails struct {
     CIDRThirdDigit      int
     CIDRLastDigit       int
     InterfacesInUse     int
+    TrunkInterfaces     int
+    BranchInterfaces    int
+    BranchIPs           int
+    InterfaceIPs        int
     AllocatedIPs        int
     FreeIPs             int
     MaxPrefixes         int
     PrefixesInUse       int
     AvailablePrefixes   []string
+    Reservations        []CIDRReservation
+    ExplicitReservedIPs int
+    // IPs of explicit reservations that no network interface uses
+    ExplicitReservedUnusedIPs int
+    // Available prefixes inside prefix reservations and outside any reservation
+    ReservedAvailablePrefixes   int
+    UnreservedAvailablePrefixes int
 }
 
 func CalculateMaxIPs(cidr string) (float64, error) {
@@ -125,10 +144,17 @@ func DescribeNetworkInterfacesBySubnetID(ctx context.Context, ec2Client *ec2.Cli
 func EnrichIPsAndPrefixes(output *ec2.DescribeNetworkInterfacesOutput, details *SubnetDetails) (map[string]bool, map[string]bool, error) {
     prefixesInUse := make(map[string]bool)
     ipsInUse := make(map[string]bool)
-    ipsPerPrefix := 16
 
     for _, iface := range output.NetworkInterfaces {
         details.InterfacesInUse++
+        switch iface.InterfaceType {
+        case types.NetworkInterfaceTypeTrunk:
+            details.TrunkInterfaces++
+        case types.NetworkInterfaceTypeBranch:
+            // branch interfaces hold the IP of a single pod using security groups for pods
+            details.BranchInterfaces++
+            details.BranchIPs += len(iface.PrivateIpAddresses)
+        }
         for _, privateIP := range iface.PrivateIpAddresses {
             ipsInUse[aws.ToString(privateIP.PrivateIpAddress)] = true
         }
@@ -138,38 +164,48 @@ func EnrichIPsAndPrefixes(output *ec2.DescribeNetworkInterfacesOutput, details *
     }
 
     details.PrefixesInUse = len(prefixesInUse)
-    details.AllocatedIPs = (details.PrefixesInUse * ipsPerPrefix) + len(ipsInUse) + 5
-    details.MaxPrefixes = details.TotalIPs / ipsPerPrefix
+    details.InterfaceIPs = len(ipsInUse)
+    details.AllocatedIPs = (details.PrefixesInUse * IPsPerPrefix) + details.InterfaceIPs + AWSReservedIPs
+    details.MaxPrefixes = details.TotalIPs / IPsPerPrefix
 
     return prefixesInUse, ipsInUse, nil
 }
 
 func CalculatePrefixes(details *SubnetDetails, prefixesInUse map[string]bool, ipsInUse map[string]bool) {
-    ipsPerPrefix := 16
     availablePrefixes := []string{}
+    details.ReservedAvailablePrefixes = 0
+    details.UnreservedAvailablePrefixes = 0
 
-    baseFirstDigit := details.CIDRFirstDigit
-    baseSecondDigit := details.CIDRSecondDigit
-    baseThirdDigit := details.CIDRThirdDigit
-    baseLastDigit := details.CIDRLastDigit
+    base := addrToUint32(netip.AddrFrom4([4]byte{
+        byte(details.CIDRFirstDigit),
+        byte(details.CIDRSecondDigit),
+        byte(details.CIDRThirdDigit),
+        byte(details.CIDRLastDigit),
+    }))
 
-    for i := 1; i <= details.MaxPrefixes; i++ {
+    // AWS never delegates a prefix holding one of the addresses it reserves
+    first := base + awsReservedLeadingIPs
+    last := base + uint32(details.TotalIPs) - 1 - (AWSReservedIPs - awsReservedLeadingIPs)
 
-        baseLastDigit += ipsPerPrefix
-        if baseLastDigit > 255 {
-            baseThirdDigit++
-            baseLastDigit = 0
+    for i := 0; i < details.MaxPrefixes; i++ {
+        start := base + uint32(i*IPsPerPrefix)
+        if start < first || start+IPsPerPrefix-1 > last {
+            continue
         }
-
-        prefix := fmt.Sprintf("%d.%d.%d.%d/%d", baseFirstDigit, baseSecondDigit, baseThirdDigit, baseLastDigit, 28)
+        prefix := netip.PrefixFrom(uint32ToAddr(start), 28).String()
 
         if prefixesInUse[prefix] {
             continue
         }
 
+        reservation := reservationType(prefix, details.Reservations)
+        if reservation == ReservationTypeExplicit {
+            continue
+        }
+
         isAvailable := true
-        for j := 0; j < ipsPerPrefix; j++ {
-            ip := fmt.Sprintf("%d.%d.%d.%d", baseFirstDigit, baseSecondDigit, baseThirdDigit, baseLastDigit+j)
+        for j := 0; j < IPsPerPrefix; j++ {
+            ip := uint32ToAddr(start + uint32(j)).String()
             if ipsInUse[ip] {
                 isAvailable = false
                 break
@@ -178,10 +214,18 @@ func CalculatePrefixes(details *SubnetDetails, prefixesInUse map[string]bool, ip
 
         if isAvailable {
             availablePrefixes = append(availablePrefixes, prefix)
+            if reservation == ReservationTypePrefix {
+                details.ReservedAvailablePrefixes++
+            } else {
+                details.UnreservedAvailablePrefixes++
+            }
         }
     }
 
     details.AvailablePrefixes = availablePrefixes
+    // unused IPs of explicit reservations can only be assigned manually
+    details.ExplicitReservedUnusedIPs = unusedExplicitReservedIPs(details.Reservations, ipsInUse)
+    details.AllocatedIPs += details.ExplicitReservedUnusedIPs
     details.FreeIPs = details.TotalIPs - details.AllocatedIPs
 
 }
@@ -193,4 +237,40 @@ func GetNameFromTags(tags []types.Tag) string {
 		}
 	}
 	return "No name tag found"
-}
\ No newline at end of file
+}
+
+func GetTagsMap(tags []types.Tag) map[string]string {
+	tagsMap := make(map[string]string, len(tags))
+	for _, v := range tags {
+		tagsMap[aws.ToString(v.Key)] = aws.ToString(v.Value)
+	}
+	return tagsMap
+}
+
+// Split a comma separated list, dropping empty items
+func SplitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Parse a comma separated list of key=value pairs, a key may only be given once
+func ParseLabels(s string) (map[string]string, error) {
+	labels := map[string]string{}
+	for _, pair := range SplitList(s) {
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid label pair: %q", pair)
+		}
+		if _, ok := labels[key]; ok {
+			return nil, fmt.Errorf("duplicate label: %q", key)
+		}
+		labels[key] = strings.TrimSpace(value)
+	}
+	return labels, nil
+}
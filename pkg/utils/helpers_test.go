@@ -2,6 +2,8 @@ package utils
 
 import (
 	"fmt"
+	"net/netip"
+	"reflect"
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -74,6 +76,32 @@ func TestCalculateMaxIPs(t *testing.T) {
 	}
 }
 
+func TestParseLabels(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		want      map[string]string
+		expectErr bool
+	}{
+		{name: "Empty string", input: "", want: map[string]string{}},
+		{name: "Pairs", input: "team=platform, app.kubernetes.io/name = exporter,empty=", want: map[string]string{"team": "platform", "app.kubernetes.io/name": "exporter", "empty": ""}},
+		{name: "Missing value separator", input: "team", expectErr: true},
+		{name: "Missing key", input: "=platform", expectErr: true},
+		{name: "Duplicate key", input: "env=a,env=b", expectErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLabels(tt.input)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("ParseLabels() error = %v, expectErr %v", err, tt.expectErr)
+			}
+			if !tt.expectErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseLabels() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestSplitCIDR(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -345,4 +373,142 @@ func mapsEqual(a, b map[string]bool) bool {
         }
     }
     return true
-}
\ No newline at end of file
+}
+
+func TestCalculatePrefixesWithReservations(t *testing.T) {
+    details := &SubnetDetails{
+        TotalIPs:        256,
+        MaxPrefixes:     16,
+        CIDRFirstDigit:  172,
+        CIDRSecondDigit: 16,
+        CIDRThirdDigit:  1,
+        CIDRLastDigit:   0,
+        Reservations: []CIDRReservation{
+            {CIDR: "172.16.1.64/26", Type: ReservationTypePrefix},
+            {CIDR: "172.16.1.200/29", Type: ReservationTypeExplicit},
+        },
+        // 2 IPs, 1 prefix and the AWS reserved IPs
+        AllocatedIPs: 2 + IPsPerPrefix + AWSReservedIPs,
+    }
+    prefixesInUse := map[string]bool{"172.16.1.64/28": true}
+    ipsInUse := map[string]bool{"172.16.1.20": true, "172.16.1.201": true}
+
+    CalculatePrefixes(details, prefixesInUse, ipsInUse)
+
+    available := map[string]bool{}
+    for _, prefix := range details.AvailablePrefixes {
+        available[prefix] = true
+    }
+    // .16 holds a used IP, .64 is in use and .192 overlaps the explicit reservation
+    for _, prefix := range []string{"172.16.1.16/28", "172.16.1.64/28", "172.16.1.192/28"} {
+        if available[prefix] {
+            t.Errorf("CalculatePrefixes() returned %v as available", prefix)
+        }
+    }
+    for _, prefix := range []string{"172.16.1.32/28", "172.16.1.80/28", "172.16.1.208/28"} {
+        if !available[prefix] {
+            t.Errorf("CalculatePrefixes() did not return %v as available", prefix)
+        }
+    }
+    if details.ReservedAvailablePrefixes != 3 {
+        t.Errorf("CalculatePrefixes() reserved available = %v, want 3", details.ReservedAvailablePrefixes)
+    }
+    if details.ReservedAvailablePrefixes+details.UnreservedAvailablePrefixes != len(details.AvailablePrefixes) {
+        t.Errorf("CalculatePrefixes() reserved and unreserved prefixes do not add up to %v", len(details.AvailablePrefixes))
+    }
+    // 7 of the 8 explicitly reserved IPs are not in use and cannot be handed out
+    if details.ExplicitReservedUnusedIPs != 7 {
+        t.Errorf("CalculatePrefixes() unused explicitly reserved IPs = %v, want 7", details.ExplicitReservedUnusedIPs)
+    }
+    if details.FreeIPs != 256-23-7 {
+        t.Errorf("CalculatePrefixes() free IPs = %v, want %v", details.FreeIPs, 256-23-7)
+    }
+}
+
+func TestEnrichIPsAndPrefixesTrunkAndBranch(t *testing.T) {
+    output := &ec2.DescribeNetworkInterfacesOutput{
+        NetworkInterfaces: []types.NetworkInterface{
+            {
+                InterfaceType: types.NetworkInterfaceTypeTrunk,
+                PrivateIpAddresses: []types.NetworkInterfacePrivateIpAddress{
+                    {PrivateIpAddress: aws.String("172.16.1.10")},
+                },
+            },
+            {
+                InterfaceType: types.NetworkInterfaceTypeBranch,
+                PrivateIpAddresses: []types.NetworkInterfacePrivateIpAddress{
+                    {PrivateIpAddress: aws.String("172.16.1.11")},
+                },
+            },
+            {
+                InterfaceType: types.NetworkInterfaceTypeBranch,
+                PrivateIpAddresses: []types.NetworkInterfacePrivateIpAddress{
+                    {PrivateIpAddress: aws.String("172.16.1.12")},
+                },
+            },
+            {
+                InterfaceType: types.NetworkInterfaceTypeInterface,
+                PrivateIpAddresses: []types.NetworkInterfacePrivateIpAddress{
+                    {PrivateIpAddress: aws.String("172.16.1.13")},
+                },
+            },
+        },
+    }
+    details := &SubnetDetails{TotalIPs: 256}
+
+    if _, _, err := EnrichIPsAndPrefixes(output, details); err != nil {
+        t.Fatal(err)
+    }
+    if details.InterfacesInUse != 4 || details.TrunkInterfaces != 1 || details.BranchInterfaces != 2 || details.BranchIPs != 2 {
+        t.Errorf("EnrichIPsAndPrefixes() interfaces = %v, trunk = %v, branch = %v, branch IPs = %v, want 4, 1, 2, 2",
+            details.InterfacesInUse, details.TrunkInterfaces, details.BranchInterfaces, details.BranchIPs)
+    }
+    if details.AllocatedIPs != 4+AWSReservedIPs {
+        t.Errorf("EnrichIPsAndPrefixes() allocated IPs = %v, want %v", details.AllocatedIPs, 4+AWSReservedIPs)
+    }
+}
+
+func TestCalculatePrefixesInsideSubnet(t *testing.T) {
+    tests := []struct {
+        cidr  string
+        first string
+        want  int
+    }{
+        // the first and last /28 hold addresses AWS reserves
+        {cidr: "10.0.0.0/24", first: "10.0.0.16/28", want: 14},
+        {cidr: "10.0.0.240/28", want: 0},
+        {cidr: "10.0.0.0/27", want: 0},
+        {cidr: "10.0.0.0/22", first: "10.0.0.16/28", want: 62},
+    }
+    for _, tt := range tests {
+        t.Run(tt.cidr, func(t *testing.T) {
+            details, err := EnrichSubnetData(&ec2.DescribeSubnetsOutput{
+                Subnets: []types.Subnet{{CidrBlock: aws.String(tt.cidr)}},
+            })
+            if err != nil {
+                t.Fatal(err)
+            }
+            details.MaxPrefixes = details.TotalIPs / IPsPerPrefix
+
+            CalculatePrefixes(details, map[string]bool{}, map[string]bool{})
+
+            if len(details.AvailablePrefixes) != tt.want {
+                t.Errorf("CalculatePrefixes() returned %v prefixes, want %v", len(details.AvailablePrefixes), tt.want)
+            }
+            if len(details.AvailablePrefixes) > 0 && details.AvailablePrefixes[0] != tt.first {
+                t.Errorf("CalculatePrefixes() first prefix = %v, want %v", details.AvailablePrefixes[0], tt.first)
+            }
+            subnet := netip.MustParsePrefix(tt.cidr)
+            broadcast := uint32ToAddr(addrToUint32(subnet.Addr()) + uint32(details.TotalIPs) - 1)
+            for _, prefix := range details.AvailablePrefixes {
+                p := netip.MustParsePrefix(prefix)
+                if !subnet.Contains(p.Addr()) || p.Bits() < subnet.Bits() {
+                    t.Errorf("CalculatePrefixes() returned %v outside of %v", prefix, tt.cidr)
+                }
+                if p.Contains(subnet.Addr()) || p.Contains(broadcast) {
+                    t.Errorf("CalculatePrefixes() returned %v holding an AWS reserved IP", prefix)
+                }
+            }
+        })
+    }
+}
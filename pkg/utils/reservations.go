@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+const (
+	// Reservation only used for delegated prefixes
+	ReservationTypePrefix = string(types.SubnetCidrReservationTypePrefix)
+	// Reservation only used for manually assigned IPs, never for secondary IPs or prefixes
+	ReservationTypeExplicit = string(types.SubnetCidrReservationTypeExplicit)
+)
+
+// Subnet CIDR reservation
+type CIDRReservation struct {
+	ReservationID string `json:"reservationId"`
+	CIDR          string `json:"cidr"`
+	Type          string `json:"type"`
+}
+
+// Get every CIDR reservation of the subnet, following the pages of results into one output
+func DescribeCidrReservationsBySubnetID(ctx context.Context, ec2Client *ec2.Client, subnetID string) (*ec2.GetSubnetCidrReservationsOutput, error) {
+	output := &ec2.GetSubnetCidrReservationsOutput{}
+	input := &ec2.GetSubnetCidrReservationsInput{
+		SubnetId: aws.String(subnetID),
+	}
+	for {
+		page, err := ec2Client.GetSubnetCidrReservations(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get subnet CIDR reservations: %w", err)
+		}
+		output.SubnetIpv4CidrReservations = append(output.SubnetIpv4CidrReservations, page.SubnetIpv4CidrReservations...)
+		output.SubnetIpv6CidrReservations = append(output.SubnetIpv6CidrReservations, page.SubnetIpv6CidrReservations...)
+		if aws.ToString(page.NextToken) == "" {
+			return output, nil
+		}
+		input.NextToken = page.NextToken
+	}
+}
+
+func EnrichReservations(output *ec2.GetSubnetCidrReservationsOutput, details *SubnetDetails) error {
+	details.Reservations = nil
+	details.ExplicitReservedIPs = 0
+	for _, r := range output.SubnetIpv4CidrReservations {
+		reservation := CIDRReservation{
+			ReservationID: aws.ToString(r.SubnetCidrReservationId),
+			CIDR:          aws.ToString(r.Cidr),
+			Type:          string(r.ReservationType),
+		}
+		prefix, err := netip.ParsePrefix(reservation.CIDR)
+		if err != nil {
+			return fmt.Errorf("invalid CIDR reservation: %w", err)
+		}
+		if reservation.Type == ReservationTypeExplicit {
+			details.ExplicitReservedIPs += PrefixSize(prefix)
+		}
+		details.Reservations = append(details.Reservations, reservation)
+	}
+	return nil
+}
+
+// Reservation type covering the whole of the prefix, or overlapping it in the case of
+// explicit reservations which make any IP they hold unusable for delegated prefixes.
+// Returns an empty string when the prefix is unreserved.
+func reservationType(prefix string, reservations []CIDRReservation) string {
+	p, err := netip.ParsePrefix(prefix)
+	if err != nil {
+		return ""
+	}
+	reserved := ""
+	for _, r := range reservations {
+		rp, err := netip.ParsePrefix(r.CIDR)
+		if err != nil || !rp.Overlaps(p) {
+			continue
+		}
+		if r.Type == ReservationTypeExplicit {
+			return ReservationTypeExplicit
+		}
+		if rp.Bits() <= p.Bits() {
+			reserved = r.Type
+		}
+	}
+	return reserved
+}
+
+// Addresses in explicit reservations that no network interface uses. AWS only assigns
+// them when asked for explicitly, so they are not free for secondary IPs or prefixes.
+func unusedExplicitReservedIPs(reservations []CIDRReservation, ipsInUse map[string]bool) int {
+	unused := 0
+	for _, r := range reservations {
+		if r.Type != ReservationTypeExplicit {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(r.CIDR)
+		if err != nil {
+			continue
+		}
+		prefix = prefix.Masked()
+		for addr := prefix.Addr(); prefix.Contains(addr); addr = addr.Next() {
+			if !ipsInUse[addr.String()] {
+				unused++
+			}
+		}
+	}
+	return unused
+}